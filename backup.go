@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Backup writes a consistent copy of the database file, and returns the number of written bytes
+func (t *DB) Backup(w io.Writer) (n int64, err error) {
+	err = t.view(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return
+}
+
+// BackupToFile writes the backup to a temporary file and renames it to path,
+// so path is either the old file or the complete backup
+func (t *DB) BackupToFile(path string) (n int64, err error) {
+	err = writeFileAtomic(path, func(w io.Writer) (err error) {
+		n, err = t.Backup(w)
+		return
+	})
+	return
+}
+
+// Restore replaces the database by the backup file at path, the file is checked before it is swapped in.
+// The transactions wait until the restore is done, the leased blocks of the sequences are dropped.
+func (t *DB) Restore(path string) error {
+	if t.opts.ReadOnly || t.readOnly.Load() {
+		return ErrReadOnly
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// copy next to the database, so the swap is a rename
+	dst := t.db.Path()
+	tmp, err := createTemp(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err := checkFile(tmp); err != nil {
+		return errors.Wrapf(err, "backup: %s", path)
+	}
+
+	t.swap.Lock()
+	defer t.swap.Unlock()
+	if err := t.swapFile(tmp); err != nil {
+		return err
+	}
+
+	// the blocks leased by the sequences are dropped, they lease new ones from the restored counters
+	t.restores.Add(1)
+	return nil
+}
+
+// swapFile replaces the database file by the file at path, the caller holds the swap lock
+func (t *DB) swapFile(path string) error {
+	dst := t.db.Path()
+	if err := t.db.Close(); err != nil {
+		return err
+	}
+	renameErr := os.Rename(path, dst)
+	db, err := bolt.Open(dst, 0666, bolt.DefaultOptions)
+	if err != nil {
+		return err
+	}
+	t.db = db
+	return renameErr
+}
+
+// checkFile opens the database file and checks its pages
+func checkFile(path string) error {
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return errors.Wrap(ErrInvalidDB, err.Error())
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		// drain the channel, the check stops when it is closed
+		var first error
+		for err := range tx.Check() {
+			if first == nil {
+				first = errors.Wrap(ErrInvalidDB, err.Error())
+			}
+		}
+		return first
+	})
+}
+
+// BackupIncremental writes the log entries from the sequence from (included) as batches of json lines,
+// and returns the sequence of the last written entry. Apply them by ApplyIncremental on a restored backup.
+func (t *DB) BackupIncremental(w io.Writer, from uint64) (last uint64, err error) {
+	if from == 0 {
+		from = 1
+	}
+
+	sender := NewStreamSender(w)
+	err = t.view(func(tx *bolt.Tx) error {
+		if first := firstLogSeq(tx); first > from {
+			return errors.Wrapf(ErrLogTruncated, "from: %d, first: %d", from, first)
+		}
+
+		batch := &LogBatch{}
+		if b := tx.Bucket(logBucket); b != nil {
+			batch.Head = b.Sequence()
+		}
+		err := readLog(tx, from, 0, func(e LogEntry) (bool, error) {
+			batch.Entries = append(batch.Entries, e)
+			last = e.Seq
+			if len(batch.Entries) < shipBatchSize {
+				return false, nil
+			}
+			err := sender.Send(batch)
+			batch.Entries = batch.Entries[:0]
+			return err != nil, err
+		})
+		if err != nil || len(batch.Entries) == 0 {
+			return err
+		}
+		return sender.Send(batch)
+	})
+	return
+}
+
+// ApplyIncremental applies the entries written by BackupIncremental after the last sequence of the log,
+// the entries already in the log are skipped. It returns the sequence of the last applied entry.
+func (t *DB) ApplyIncremental(r io.Reader) (last uint64, err error) {
+	if t.readOnly.Load() {
+		return 0, ErrReadOnly
+	}
+
+	receiver := NewStreamReceiver(r)
+	for {
+		batch, err := receiver.Receive(context.Background())
+		if errors.Is(err, io.EOF) {
+			return last, nil
+		}
+		if err != nil {
+			return last, err
+		}
+
+		var txn *Txn
+		err = t.update(func(tx *bolt.Tx) error {
+			txn = &Txn{t: tx, db: t, record: t.watching()}
+			var applied uint64
+			if b := tx.Bucket(logBucket); b != nil {
+				applied = b.Sequence()
+			}
+			applied, _, err := txn.applyLog(batch.Entries, applied)
+			last = applied
+			return err
+		})
+		if err != nil {
+			return last, err
+		}
+		t.publish(txn.events)
+	}
+}
+
+// createTemp writes a temporary file next to path, and returns its name
+func createTemp(path string, write func(w io.Writer) error) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return "", err
+	}
+
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// writeFileAtomic writes to a temporary file and renames it to path
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := createTemp(path, write)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
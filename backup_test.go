@@ -0,0 +1,156 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(filepath.Join(dir, "db"), &Options{ChangeLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	set := func(key, value string) {
+		t.Helper()
+		if err := db.Txn(func(txn *Txn) error { return txn.Set(key, value) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(key string) string {
+		t.Helper()
+		var value []byte
+		db.Txn(func(txn *Txn) error {
+			value, _ = txn.Get(key)
+			return nil
+		}, true)
+		return string(value)
+	}
+
+	set("a:1", "one")
+	full := filepath.Join(dir, "full.db")
+	if _, err := db.BackupToFile(full); err != nil {
+		t.Fatal(err)
+	}
+	seq := db.LastLogSeq()
+
+	set("a:2", "two")
+	set("a:1", "uno")
+	var incremental bytes.Buffer
+	last, err := db.BackupIncremental(&incremental, seq+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != db.LastLogSeq() {
+		t.Errorf("expected last %d but got %d", db.LastLogSeq(), last)
+	}
+
+	// the full backup is swapped in
+	if err := db.Restore(full); err != nil {
+		t.Fatal(err)
+	}
+	if v := get("a:1"); v != "one" {
+		t.Errorf("expected one but got %s", v)
+	}
+	if v := get("a:2"); v != "" {
+		t.Errorf("expected a:2 to be missing but got %s", v)
+	}
+
+	// then the changes after it are applied
+	applied, err := db.ApplyIncremental(bytes.NewReader(incremental.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != last {
+		t.Errorf("expected applied %d but got %d", last, applied)
+	}
+	if v := get("a:1"); v != "uno" {
+		t.Errorf("expected uno but got %s", v)
+	}
+	if v := get("a:2"); v != "two" {
+		t.Errorf("expected two but got %s", v)
+	}
+
+	// a second run skips the applied entries
+	if _, err := db.ApplyIncremental(bytes.NewReader(incremental.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	// an invalid file is rejected and the database is kept
+	bad := filepath.Join(dir, "bad.db")
+	if err := os.WriteFile(bad, []byte("not a database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Restore(bad); !errors.Is(err, ErrInvalidDB) {
+		t.Fatalf("expected ErrInvalidDB but got %v", err)
+	}
+	if v := get("a:2"); v != "two" {
+		t.Errorf("expected two but got %s", v)
+	}
+}
+
+func TestRestoreSequence(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(filepath.Join(dir, "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type Ticket struct{}
+	db.SetSequenceLease(&Ticket{}, 1)
+	seq := db.Sequence(&Ticket{})
+	if _, err := seq.Next(); err != nil {
+		t.Fatal(err)
+	}
+	bak := filepath.Join(dir, "bak.db")
+	if _, err := db.BackupToFile(bak); err != nil {
+		t.Fatal(err)
+	}
+
+	// Next and Restore run at the same time
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				done <- nil
+				return
+			default:
+			}
+			if _, err := seq.Next(); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := db.Restore(bak); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Next is blocked")
+	}
+
+	// the block leased before the restore is not used
+	if err := db.Restore(bak); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := seq.Next(); err != nil || n != 2 {
+		t.Errorf("expected 2 but got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,325 @@
+package db
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The change log is stored in the bucket "_log" keyed by the 8 bytes big-endian sequence,
+// the entry is: 1 byte type, 8 bytes unix nano, uvarint key length, key, stored value.
+// The offsets of the consumers are stored in the bucket "_log_offset", both buckets are not logged.
+var (
+	logBucket       = []byte("_log")
+	logOffsetBucket = []byte("_log_offset")
+)
+
+var (
+	ErrInvalidLogEntry = errors.New("invalid log entry")
+	ErrLogTruncated    = errors.New("the log is truncated beyond the offset")
+)
+
+// LogEntry is a committed change of a key
+type LogEntry struct {
+	Seq  uint64
+	Time time.Time
+	Type EventType
+	Key  string
+	Raw  []byte // the stored value, which may be compressed
+}
+
+// Value returns the uncompressed value
+func (e LogEntry) Value() []byte {
+	return decodeValue(e.Raw)
+}
+
+// the json form of the entry keeps binary keys
+type logEntryJSON struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+	Key  []byte    `json:"key"`
+	Raw  []byte    `json:"raw,omitempty"`
+}
+
+func (e LogEntry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(logEntryJSON{e.Seq, e.Time, e.Type, []byte(e.Key), e.Raw})
+}
+
+func (e *LogEntry) UnmarshalJSON(data []byte) error {
+	var v logEntryJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*e = LogEntry{Seq: v.Seq, Time: v.Time, Type: v.Type, Key: string(v.Key), Raw: v.Raw}
+	return nil
+}
+
+func seqKey(seq uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, seq)
+	return buf
+}
+
+func encodeLogEntry(e LogEntry) []byte {
+	buf := make([]byte, 0, 1+8+binary.MaxVarintLen64+len(e.Key)+len(e.Raw))
+	buf = append(buf, byte(e.Type))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.Time.UnixNano()))
+	buf = binary.AppendUvarint(buf, uint64(len(e.Key)))
+	buf = append(buf, e.Key...)
+	return append(buf, e.Raw...)
+}
+
+func decodeLogEntry(seq, raw []byte) (LogEntry, error) {
+	if len(seq) != 8 || len(raw) < 9 {
+		return LogEntry{}, ErrInvalidLogEntry
+	}
+	e := LogEntry{
+		Seq:  binary.BigEndian.Uint64(seq),
+		Type: EventType(raw[0]),
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(raw[1:9]))),
+	}
+	n, size := binary.Uvarint(raw[9:])
+	if size <= 0 || uint64(len(raw)-9-size) < n {
+		return LogEntry{}, errors.Wrapf(ErrInvalidLogEntry, "seq: %d", e.Seq)
+	}
+	rest := raw[9+size:]
+	e.Key = string(rest[:n])
+	if e.Type == EventPut {
+		e.Raw = append([]byte{}, rest[n:]...)
+	}
+	return e, nil
+}
+
+func (txn *Txn) appendLog(typ EventType, key string, value []byte) error {
+	b, err := txn.t.CreateBucketIfNotExists(logBucket)
+	if err != nil {
+		return err
+	}
+	b.FillPercent = 1.0
+
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	return b.Put(seqKey(seq), encodeLogEntry(LogEntry{Time: txn.now(), Type: typ, Key: key, Raw: value}))
+}
+
+// LastLogSeq returns the sequence of the last logged change
+func (t *DB) LastLogSeq() (seq uint64) {
+	t.view(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(logBucket); b != nil {
+			seq = b.Sequence()
+		}
+		return nil
+	})
+	return
+}
+
+// firstLogSeq returns the sequence of the first entry, the next sequence if the log is empty
+func firstLogSeq(tx *bolt.Tx) uint64 {
+	b := tx.Bucket(logBucket)
+	if b == nil {
+		return 1
+	}
+	k, _ := b.Cursor().First()
+	if k == nil {
+		return b.Sequence() + 1
+	}
+	return binary.BigEndian.Uint64(k)
+}
+
+// ReadLog iterates over the log entries from the sequence from (included)
+func (t *DB) ReadLog(from uint64, limit int, fn func(e LogEntry) (stop bool, err error)) error {
+	return t.view(func(tx *bolt.Tx) error {
+		return readLog(tx, from, limit, fn)
+	})
+}
+
+func readLog(tx *bolt.Tx, from uint64, limit int, fn func(e LogEntry) (stop bool, err error)) error {
+	b := tx.Bucket(logBucket)
+	if b == nil {
+		return nil
+	}
+
+	c := b.Cursor()
+	i := 0
+	for k, v := c.Seek(seqKey(from)); k != nil; k, v = c.Next() {
+		e, err := decodeLogEntry(k, v)
+		if err != nil {
+			return err
+		}
+		if stop, err := fn(e); err != nil || stop {
+			return err
+		}
+		i++
+		if limit > 0 && i >= limit {
+			break
+		}
+	}
+	return nil
+}
+
+// TruncateLog deletes the log entries before the sequence, and returns the number of deleted entries
+func (t *DB) TruncateLog(before uint64) (n int, err error) {
+	err = t.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(logBucket)
+		if b == nil {
+			return nil
+		}
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) < before; k, _ = c.Next() {
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(keys)
+		return nil
+	})
+	return
+}
+
+// applyLogRetention truncates the log by LogRetention and LogMaxEntries
+func (t *DB) applyLogRetention() (int, error) {
+	if t.opts.LogRetention <= 0 && t.opts.LogMaxEntries <= 0 {
+		return 0, nil
+	}
+
+	var before uint64
+	err := t.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(logBucket)
+		if b == nil {
+			return nil
+		}
+		if t.opts.LogMaxEntries > 0 && b.Sequence() > uint64(t.opts.LogMaxEntries) {
+			before = b.Sequence() - uint64(t.opts.LogMaxEntries) + 1
+		}
+		if t.opts.LogRetention <= 0 {
+			return nil
+		}
+
+		// the first entry newer than the retention
+		deadline := t.now().Add(-t.opts.LogRetention)
+		c := b.Cursor()
+		for k, v := c.Seek(seqKey(before)); k != nil; k, v = c.Next() {
+			e, err := decodeLogEntry(k, v)
+			if err != nil {
+				return err
+			}
+			if e.Time.After(deadline) {
+				break
+			}
+			before = e.Seq + 1
+		}
+		return nil
+	})
+	if err != nil || before == 0 {
+		return 0, err
+	}
+	return t.TruncateLog(before)
+}
+
+// LogConsumer reads the log from its acknowledged offset, the offset is stored in the database
+type LogConsumer struct {
+	db   *DB
+	name string
+}
+
+func (t *DB) LogConsumer(name string) *LogConsumer {
+	return &LogConsumer{db: t, name: name}
+}
+
+// Offset returns the sequence of the last acknowledged entry
+func (c *LogConsumer) Offset() (offset uint64) {
+	c.db.view(func(tx *bolt.Tx) error {
+		offset = logOffset(tx, c.name)
+		return nil
+	})
+	return
+}
+
+func logOffset(tx *bolt.Tx, name string) uint64 {
+	b := tx.Bucket(logOffsetBucket)
+	if b == nil {
+		return 0
+	}
+	v := b.Get([]byte(name))
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// Read returns at most limit entries after the offset.
+// ErrLogTruncated is returned when some entries after the offset were truncated.
+func (c *LogConsumer) Read(limit int) (list []LogEntry, err error) {
+	err = c.db.view(func(tx *bolt.Tx) error {
+		offset := logOffset(tx, c.name)
+		if first := firstLogSeq(tx); first > offset+1 {
+			return errors.Wrapf(ErrLogTruncated, "consumer: %s, offset: %d, first: %d", c.name, offset, first)
+		}
+		return readLog(tx, offset+1, limit, func(e LogEntry) (bool, error) {
+			list = append(list, e)
+			return false, nil
+		})
+	})
+	return
+}
+
+// Ack acknowledges the entries up to the sequence, the offset never goes backwards
+func (c *LogConsumer) Ack(seq uint64) error {
+	return c.db.update(func(tx *bolt.Tx) error {
+		if seq <= logOffset(tx, c.name) {
+			return nil
+		}
+		b, err := tx.CreateBucketIfNotExists(logOffsetBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(c.name), seqKey(seq))
+	})
+}
+
+// Reset moves the offset to the sequence, so the entries after it are read again
+func (c *LogConsumer) Reset(seq uint64) error {
+	return c.db.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(logOffsetBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(c.name), seqKey(seq))
+	})
+}
+
+// ExportLog writes the log entries from the sequence from (included) as NDJSON,
+// and returns the sequence of the last written entry
+func (t *DB) ExportLog(w io.Writer, from uint64) (last uint64, err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	err = t.ReadLog(from, 0, func(e LogEntry) (bool, error) {
+		record := newRecord(e.Key, e.Value())
+		line := struct {
+			Seq  uint64    `json:"seq"`
+			Time time.Time `json:"time"`
+			Op   string    `json:"op"`
+			*Record
+		}{e.Seq, e.Time, e.Type.String(), record}
+		if e.Type == EventDelete {
+			line.Type, line.Value = "", nil
+		}
+		if err := encoder.Encode(line); err != nil {
+			return true, err
+		}
+		last = e.Seq
+		return false, nil
+	})
+	return
+}
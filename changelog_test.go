@@ -0,0 +1,136 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChangeLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := Open(path, &Options{ChangeLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.Set("a:1", "one"); err != nil {
+			return err
+		}
+		if err := txn.Set("a:2", map[string]int{"n": 2}); err != nil {
+			return err
+		}
+		return txn.Del("a:1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	err = db.ReadLog(0, 0, func(e LogEntry) (bool, error) {
+		if !isInternal(e.Key) {
+			keys = append(keys, e.Type.String()+" "+e.Key+" "+string(e.Value()))
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"put a:1 one", `put a:2 {"n":2}`, "delete a:1 "}
+	if len(keys) != len(expected) {
+		t.Fatalf("unexpected entries: %v", keys)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Errorf("expected '%v' but got '%v'", expected[i], keys[i])
+		}
+	}
+
+	// a consumer resumes from its offset after a restart
+	c := db.LogConsumer("indexer")
+	list, err := c.Read(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Seq != 1 {
+		t.Fatalf("unexpected entries: %+v", list)
+	}
+	if err := c.Ack(list[1].Seq); err != nil {
+		t.Fatal(err)
+	}
+	last := db.LastLogSeq()
+	db.Close()
+
+	db, err = Open(path, &Options{ChangeLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	c = db.LogConsumer("indexer")
+	if c.Offset() != 2 {
+		t.Fatalf("unexpected offset: %d", c.Offset())
+	}
+	list, err = c.Read(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != int(last-2) || list[len(list)-1].Seq != last {
+		t.Fatalf("unexpected entries: %d", len(list))
+	}
+
+	var buf bytes.Buffer
+	n, err := db.ExportLog(&buf, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != last {
+		t.Errorf("unexpected last: %d", n)
+	}
+	scanner := bufio.NewScanner(&buf)
+	scanner.Scan()
+	var line map[string]any
+	if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["op"] != "put" || line["key"] != "a:1" || line["value"] != "one" || line["type"] != "text" {
+		t.Errorf("unexpected line: %s", scanner.Bytes())
+	}
+
+	if _, err := db.TruncateLog(4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.LogConsumer("late").Read(0); !errors.Is(err, ErrLogTruncated) {
+		t.Errorf("expected truncated, got %v", err)
+	}
+}
+
+func TestChangeLogRetention(t *testing.T) {
+	clock := &testClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	db, err := Open(filepath.Join(t.TempDir(), "db"), &Options{ChangeLog: true, Clock: clock.Now, LogRetention: time.Hour, LogMaxEntries: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 3; i++ {
+		db.Txn(func(txn *Txn) error {
+			return txn.CounterSet("_c:a", int64(i))
+		})
+		clock.Add(time.Hour)
+	}
+
+	// the entries older than 1 hour are truncated
+	clock.Add(-30 * time.Minute)
+	n, err := db.applyLogRetention()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("unexpected truncated: %d", n)
+	}
+}
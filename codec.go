@@ -0,0 +1,56 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+// Codec encodes the uncompressed values before they are stored.
+// The values are read by gunzip, or as is when they are not gzip data, so a codec writes one of them.
+type Codec interface {
+	Encode(value []byte) ([]byte, error)
+}
+
+var (
+	// DefaultCodec compresses a value by gzip when it gets smaller, it is used by Set
+	DefaultCodec Codec = gzipCodec{level: gzip.DefaultCompression}
+	// RawCodec stores the values uncompressed
+	RawCodec Codec = rawCodec{}
+)
+
+// NewGzipCodec returns a codec compressing with the level when the value gets smaller
+func NewGzipCodec(level int) Codec {
+	return gzipCodec{level: level}
+}
+
+type gzipCodec struct {
+	level int
+}
+
+func (c gzipCodec) Encode(value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if b.Len() > len(value) {
+		return value, nil
+	}
+	return b.Bytes(), nil
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Encode(value []byte) ([]byte, error) {
+	return value, nil
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	defaultCompactTxSize = 64 << 20
+
+	// compaction is recommended when the free pages take this much of the file
+	compactMinFreeRatio = 0.3
+	compactMinFreeBytes = 16 << 20
+)
+
+type CompactOptions struct {
+	Codec       Codec   // Re-encode the values of the data buckets, the values are kept as is by default
+	FillPercent float64 // The fill percent of the pages, bolt.DefaultFillPercent by default, 1.0 packs them
+	TxMaxSize   int64   // The bytes copied in one transaction of the new file, 64MB by default
+}
+
+type CompactResult struct {
+	SrcSize int64 // the size of the old file
+	DstSize int64 // the size of the compacted file
+	Keys    int   // the number of copied keys
+}
+
+// Compact rewrites all buckets into a fresh file at dstPath in one read transaction,
+// the database keeps working while it runs.
+func (t *DB) Compact(dstPath string, opts *CompactOptions) (result CompactResult, err error) {
+	t.swap.RLock()
+	defer t.swap.RUnlock()
+	return compactFile(t.db, dstPath, opts)
+}
+
+// CompactInPlace compacts the database into a temporary file and swaps it in,
+// the transactions wait until it is done.
+func (t *DB) CompactInPlace(opts *CompactOptions) (result CompactResult, err error) {
+	if t.opts.ReadOnly || t.readOnly.Load() {
+		return result, ErrReadOnly
+	}
+
+	t.swap.Lock()
+	defer t.swap.Unlock()
+
+	tmp, err := createTemp(t.db.Path(), func(w io.Writer) error { return nil })
+	if err != nil {
+		return result, err
+	}
+	defer os.Remove(tmp)
+
+	if result, err = compactFile(t.db, tmp, opts); err != nil {
+		return result, err
+	}
+	return result, t.swapFile(tmp)
+}
+
+func compactFile(src *bolt.DB, dstPath string, opts *CompactOptions) (result CompactResult, err error) {
+	if opts == nil {
+		opts = &CompactOptions{}
+	}
+	fillPercent := opts.FillPercent
+	if fillPercent <= 0 {
+		fillPercent = bolt.DefaultFillPercent
+	}
+	txMaxSize := opts.TxMaxSize
+	if txMaxSize <= 0 {
+		txMaxSize = defaultCompactTxSize
+	}
+
+	if info, err := os.Stat(dstPath); err == nil && info.Size() > 0 {
+		return result, errors.Errorf("the file exists: %s", dstPath)
+	}
+	dst, err := bolt.Open(dstPath, 0666, nil)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			if info, statErr := os.Stat(dstPath); statErr == nil {
+				result.DstSize = info.Size()
+			}
+		}
+	}()
+
+	dstTx, err := dst.Begin(true)
+	if err != nil {
+		return result, err
+	}
+	defer func() {
+		if dstTx != nil {
+			dstTx.Rollback()
+		}
+	}()
+
+	err = src.View(func(tx *bolt.Tx) error {
+		result.SrcSize = tx.Size()
+
+		var size int64
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			// internal values have their own encodings
+			reencode := opts.Codec != nil && !isInternal(string(name))
+
+			c := b.Cursor()
+			var nb *bolt.Bucket
+			for k, v := c.First(); ; k, v = c.Next() {
+				// commit the new file in steps, so its dirty pages don't grow without bound
+				if nb == nil || size+int64(len(k)+len(v)) > txMaxSize {
+					if nb != nil {
+						if err := dstTx.Commit(); err != nil {
+							return err
+						}
+						var err error
+						if dstTx, err = dst.Begin(true); err != nil {
+							return err
+						}
+						size = 0
+					}
+					var err error
+					if nb, err = dstTx.CreateBucketIfNotExists(name); err != nil {
+						return err
+					}
+					nb.FillPercent = fillPercent
+					if err := nb.SetSequence(b.Sequence()); err != nil {
+						return err
+					}
+				}
+				if k == nil {
+					return nil
+				}
+				if v == nil {
+					// nested buckets are not used by the database
+					continue
+				}
+
+				if reencode {
+					encoded, err := opts.Codec.Encode(decodeValue(v))
+					if err != nil {
+						return err
+					}
+					v = encoded
+				}
+				if err := nb.Put(k, v); err != nil {
+					return err
+				}
+				size += int64(len(k) + len(v))
+				result.Keys++
+			}
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = dstTx.Commit()
+	dstTx = nil
+	return result, err
+}
+
+type Fragmentation struct {
+	FileSize      int64   // the size of the file
+	PageSize      int     // the size of a page
+	FreePages     int     // the pages on the freelist
+	PendingPages  int     // the freed pages still used by the open read transactions
+	FreeBytes     int64   // the bytes of the free pages
+	FreelistBytes int64   // the bytes used by the freelist itself
+	FreeRatio     float64 // the share of the file taken by the free pages
+	Recommended   bool    // compaction would shrink the file noticeably
+}
+
+// Fragmentation returns the freelist diagnostics, and whether compaction is recommended
+func (t *DB) Fragmentation() (f Fragmentation, err error) {
+	t.swap.RLock()
+	defer t.swap.RUnlock()
+
+	stats := t.db.Stats()
+	f = Fragmentation{
+		PageSize:      t.db.Info().PageSize,
+		FreePages:     stats.FreePageN,
+		PendingPages:  stats.PendingPageN,
+		FreeBytes:     int64(stats.FreeAlloc),
+		FreelistBytes: int64(stats.FreelistInuse),
+	}
+	err = t.db.View(func(tx *bolt.Tx) error {
+		f.FileSize = tx.Size()
+		return nil
+	})
+	if f.FileSize > 0 {
+		f.FreeRatio = float64(f.FreeBytes) / float64(f.FileSize)
+	}
+	f.Recommended = f.FreeBytes >= compactMinFreeBytes && f.FreeRatio >= compactMinFreeRatio
+	return
+}
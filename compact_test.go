@@ -0,0 +1,109 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(filepath.Join(dir, "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	value := strings.Repeat("abcdefgh", 512)
+	for i := 0; i < 10; i++ {
+		err = db.Txn(func(txn *Txn) error {
+			for j := 0; j < 100; j++ {
+				if err := txn.Set(fmt.Sprintf("item:%d-%d", i, j), value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.Txn(func(txn *Txn) error {
+		return txn.List("item:", func(key string, _ []byte) (bool, error) {
+			if strings.HasSuffix(key, "-0") {
+				return false, nil
+			}
+			return false, txn.Del(key)
+		}, &ListOption{KeyOnly: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := db.Fragmentation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.FileSize == 0 || f.PageSize == 0 {
+		t.Fatalf("unexpected fragmentation: %+v", f)
+	}
+
+	// the copy is readable and keeps the uncompressed values
+	dst := filepath.Join(dir, "compacted")
+	result, err := db.Compact(dst, &CompactOptions{Codec: RawCodec, FillPercent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DstSize == 0 || result.Keys == 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	copied, err := Open(dst, &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = copied.Txn(func(txn *Txn) error {
+		v, err := txn.Get("item:3-0")
+		if err != nil {
+			return err
+		}
+		if string(v) != value {
+			t.Error("unexpected value")
+		}
+		if txn.Has("item:3-1") {
+			t.Error("expected item:3-1 to be deleted")
+		}
+		return nil
+	}, true)
+	copied.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Compact(dst, nil); err == nil {
+		t.Error("expected an error for an existing file")
+	}
+
+	// the compacted file is swapped in
+	result, err = db.CompactInPlace(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.DstSize > result.SrcSize {
+		t.Errorf("expected the file to shrink: %+v", result)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		return txn.Set("item:new", "ok")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		if v, err := txn.Get("item:9-0"); err != nil || string(v) != value {
+			t.Errorf("unexpected value: %v", err)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// binary counters are stored as a type byte followed by 8 bytes big-endian,
+// the type byte can not be the first byte of a json number or a gzip stream
+const (
+	counterInt   = 0x01
+	counterFloat = 0x02
+	counterSize  = 9
+)
+
+var ErrInvalidCounter = errors.New("invalid counter")
+
+type counterValue struct {
+	float bool
+	i     int64
+	f     float64
+}
+
+func (c counterValue) Int() int64 {
+	if c.float {
+		return int64(c.f)
+	}
+	return c.i
+}
+
+func (c counterValue) Float() float64 {
+	if c.float {
+		return c.f
+	}
+	return float64(c.i)
+}
+
+func encodeCounter(c counterValue) []byte {
+	buf := make([]byte, counterSize)
+	if c.float {
+		buf[0] = counterFloat
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(c.f))
+	} else {
+		buf[0] = counterInt
+		binary.BigEndian.PutUint64(buf[1:], uint64(c.i))
+	}
+	return buf
+}
+
+// json returns the value as a json number
+func (c counterValue) json() []byte {
+	if c.float {
+		return strconv.AppendFloat(nil, c.f, 'g', -1, 64)
+	}
+	return strconv.AppendInt(nil, c.i, 10)
+}
+
+// binaryCounter decodes the value if it is a binary counter
+func binaryCounter(raw []byte) (counterValue, bool) {
+	if len(raw) == counterSize {
+		switch raw[0] {
+		case counterInt:
+			return counterValue{i: int64(binary.BigEndian.Uint64(raw[1:]))}, true
+		case counterFloat:
+			return counterValue{float: true, f: math.Float64frombits(binary.BigEndian.Uint64(raw[1:]))}, true
+		}
+	}
+	return counterValue{}, false
+}
+
+// decodeCounter reads binary counters and the json counters written by Inc and Dec before
+func decodeCounter(raw []byte) (counterValue, error) {
+	if c, ok := binaryCounter(raw); ok {
+		return c, nil
+	}
+
+	if decode, err := GzipUncompress(raw); err == nil {
+		raw = decode
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return counterValue{}, errors.Wrapf(ErrInvalidCounter, "raw: %s", raw)
+	}
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		return counterValue{i: i}, nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return counterValue{}, errors.Wrapf(ErrInvalidCounter, "raw: %s", raw)
+	}
+	return counterValue{float: true, f: f}, nil
+}
+
+// putCounter stores the counter, the keys out of the internal buckets get a new version and lose their expiry like Set
+func (txn *Txn) putCounter(key string, c counterValue) error {
+	if err := txn.put(key, encodeCounter(c)); err != nil {
+		return err
+	}
+	if isInternal(key) {
+		return nil
+	}
+	if err := txn.Persist(key); err != nil {
+		return err
+	}
+	return txn.bumpVersion(key, 0)
+}
+
+func (txn *Txn) counter(key string) (counterValue, error) {
+	raw := txn.get(key)
+	if raw == nil {
+		return counterValue{}, nil
+	}
+	c, err := decodeCounter(raw)
+	if err != nil {
+		return c, errors.WithMessagef(err, "key: %s", key)
+	}
+	return c, nil
+}
+
+// CounterGet returns the value of the counter, 0 if the counter does not exist
+func (txn *Txn) CounterGet(key string) (int64, error) {
+	c, err := txn.counter(key)
+	return c.Int(), err
+}
+
+func (txn *Txn) CounterGetFloat(key string) (float64, error) {
+	c, err := txn.counter(key)
+	return c.Float(), err
+}
+
+// CounterAdd adds delta to the counter and returns the new value
+func (txn *Txn) CounterAdd(key string, delta int64) (int64, error) {
+	c, err := txn.counter(key)
+	if err != nil {
+		return 0, err
+	}
+	val := c.Int() + delta
+	return val, txn.putCounter(key, counterValue{i: val})
+}
+
+// CounterAddFloat adds delta to the counter and returns the new value, the counter becomes a float counter
+func (txn *Txn) CounterAddFloat(key string, delta float64) (float64, error) {
+	c, err := txn.counter(key)
+	if err != nil {
+		return 0, err
+	}
+	val := c.Float() + delta
+	return val, txn.putCounter(key, counterValue{float: true, f: val})
+}
+
+func (txn *Txn) CounterSet(key string, val int64) error {
+	return txn.putCounter(key, counterValue{i: val})
+}
+
+func (txn *Txn) CounterSetFloat(key string, val float64) error {
+	return txn.putCounter(key, counterValue{float: true, f: val})
+}
+
+// CounterReset deletes the counter, so its value is 0
+func (txn *Txn) CounterReset(key string) error {
+	return txn.Del(key)
+}
+
+// CounterCompareAndSet sets the counter to val only if its value is old
+func (txn *Txn) CounterCompareAndSet(key string, old, val int64) (bool, error) {
+	c, err := txn.counter(key)
+	if err != nil {
+		return false, err
+	}
+	if c.Int() != old {
+		return false, nil
+	}
+	return true, txn.CounterSet(key, val)
+}
+
+// CounterMax sets the counter to val if val is greater, and returns the new value
+func (txn *Txn) CounterMax(key string, val int64) (int64, error) {
+	c, err := txn.counter(key)
+	if err != nil {
+		return 0, err
+	}
+	if txn.Has(key) && c.Int() >= val {
+		return c.Int(), nil
+	}
+	return val, txn.CounterSet(key, val)
+}
+
+// CounterMin sets the counter to val if val is less, and returns the new value
+func (txn *Txn) CounterMin(key string, val int64) (int64, error) {
+	c, err := txn.counter(key)
+	if err != nil {
+		return 0, err
+	}
+	if txn.Has(key) && c.Int() <= val {
+		return c.Int(), nil
+	}
+	return val, txn.CounterSet(key, val)
+}
+
+// CounterList iterates over the counters with the prefix, float counters are truncated
+func (txn *Txn) CounterList(prefix string, fn func(key string, value int64) (stop bool, err error), options ...*ListOption) error {
+	return txn.List(prefix, func(key string, value []byte) (bool, error) {
+		c, err := txn.counter(key)
+		if err != nil {
+			return true, err
+		}
+		return fn(key, c.Int())
+	}, options...)
+}
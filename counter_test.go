@@ -0,0 +1,137 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		if n, _ := txn.CounterAdd("hits:a", 5); n != 5 {
+			t.Errorf("unexpected value: %d", n)
+		}
+		if n, _ := txn.CounterAdd("hits:a", -2); n != 3 {
+			t.Errorf("unexpected value: %d", n)
+		}
+		if raw := txn.get("hits:a"); len(raw) != counterSize {
+			t.Errorf("unexpected raw: %v", raw)
+		}
+
+		if ok, _ := txn.CounterCompareAndSet("hits:a", 2, 10); ok {
+			t.Error("unexpected swap")
+		}
+		if ok, _ := txn.CounterCompareAndSet("hits:a", 3, 10); !ok {
+			t.Error("expected swap")
+		}
+		if n, _ := txn.CounterMax("hits:a", 7); n != 10 {
+			t.Errorf("unexpected value: %d", n)
+		}
+		if n, _ := txn.CounterMin("hits:a", 7); n != 7 {
+			t.Errorf("unexpected value: %d", n)
+		}
+		if n, _ := txn.CounterMin("hits:b", 7); n != 7 {
+			t.Errorf("unexpected value: %d", n)
+		}
+
+		if f, _ := txn.CounterAddFloat("hits:c", 1.5); f != 1.5 {
+			t.Errorf("unexpected value: %v", f)
+		}
+		if f, _ := txn.CounterGetFloat("hits:c"); f != 1.5 {
+			t.Errorf("unexpected value: %v", f)
+		}
+
+		if err := txn.CounterReset("hits:b"); err != nil {
+			return err
+		}
+		if n, _ := txn.CounterGet("hits:b"); n != 0 {
+			t.Errorf("unexpected value: %d", n)
+		}
+
+		sum := int64(0)
+		err := txn.CounterList("hits:", func(key string, value int64) (bool, error) {
+			sum += value
+			return false, nil
+		})
+		if err != nil {
+			return err
+		}
+		if sum != 8 {
+			t.Errorf("unexpected sum: %d", sum)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCounterLegacy(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type Item struct{}
+
+	// counters written as json by the old versions
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.Set("_total:item", 41); err != nil {
+			return err
+		}
+		if err := txn.Set("_counter:item", 12345678); err != nil {
+			return err
+		}
+		return txn.Set("ratio:x", 0.25)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if n := txn.ModelTotal(&Item{}); n != 41 {
+			t.Errorf("unexpected total: %d", n)
+		}
+		if id := txn.ModelNextID(&Item{}, 0); id != "12345679" {
+			t.Errorf("unexpected id: %s", id)
+		}
+		if f, _ := txn.CounterAddFloat("ratio:x", 0.5); f != 0.75 {
+			t.Errorf("unexpected value: %v", f)
+		}
+		if err := txn.ModelSet(&Item{}, 1); err != nil {
+			return err
+		}
+		// Inc and Dec read the counters of both formats
+		if n, err := txn.Inc("_total:item", 2); err != nil || n != 44 {
+			t.Errorf("unexpected value: %d, %v", n, err)
+		}
+		if n, err := txn.Dec("_total:item", 2); err != nil || n != 42 {
+			t.Errorf("unexpected value: %d, %v", n, err)
+		}
+		if n := txn.ModelTotal(&Item{}); n != 42 {
+			t.Errorf("unexpected total: %d", n)
+		}
+		// Unmarshal reads the binary counters as numbers
+		if _, err := txn.Inc("views:1", 3); err != nil {
+			return err
+		}
+		var views int
+		if err := txn.Unmarshal("views:1", &views); err != nil || views != 3 {
+			t.Errorf("unexpected value: %d, %v", views, err)
+		}
+		var ratio float64
+		if err := txn.Unmarshal("ratio:x", &ratio); err != nil || ratio != 0.75 {
+			t.Errorf("unexpected value: %v, %v", ratio, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
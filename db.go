@@ -1,40 +1,197 @@
 package db
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	bolt "go.etcd.io/bbolt"
 )
 
+const defaultChunkSize = 1000
+
 type DB struct {
-	db *bolt.DB
+	db        *bolt.DB
+	opts      Options
+	readOnly  atomic.Bool  // writes are rejected, such as a replica
+	changeLog atomic.Bool  // the writes are recorded in the change log, a promoted replica starts it
+	restores  atomic.Int64 // the number of restores, the sequences compare it with the one of their blocks
+	swap      sync.RWMutex // held by the transactions, Restore locks it to swap the file
+
+	seqMutex  sync.Mutex
+	sequences map[string]*Sequence
+	seqLeases map[string]int64
+
+	watchers watchers
+	hooks    hooks
+
+	stop chan struct{}
+	wg   sync.WaitGroup
 }
 
 // or set env: DATABASE_DIR
 func New(dir string, readOnly bool) (*DB, error) {
-	opts := bolt.DefaultOptions
+	opts := DefaultOptions
 	opts.ReadOnly = readOnly
-	db, err := bolt.Open(dir, 0666, opts)
+	return Open(dir, &opts)
+}
+
+func Open(dir string, options *Options) (*DB, error) {
+	opts := DefaultOptions
+	if options != nil {
+		opts = *options
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	if opts.SweepBatch <= 0 {
+		opts.SweepBatch = DefaultOptions.SweepBatch
+	}
+	if opts.WatchQueue <= 0 {
+		opts.WatchQueue = DefaultOptions.WatchQueue
+	}
+
+	// copy the default options, they are shared by all databases
+	boltOpts := *bolt.DefaultOptions
+	boltOpts.ReadOnly = opts.ReadOnly
+	db, err := bolt.Open(dir, 0666, &boltOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DB{db: db}, nil
+	t := &DB{db: db, opts: opts, stop: make(chan struct{})}
+	t.changeLog.Store(opts.ChangeLog)
+	if !opts.ReadOnly && len(opts.Migrations) > 0 {
+		if _, err := t.Migrate(opts.Migrations, nil); err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+	if !opts.ReadOnly {
+		t.startSweeper(opts.SweepInterval)
+	}
+	return t, nil
+}
+
+func (t *DB) startSweeper(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	t.wg.Add(1)
+	go t.sweep(interval)
 }
 
 func (t *DB) Close() {
 	if t.db != nil {
+		// stop the background jobs
+		close(t.stop)
+		t.wg.Wait()
+
+		// return the unused ids of the sequences
+		if !t.db.IsReadOnly() {
+			t.seqMutex.Lock()
+			for _, s := range t.sequences {
+				s.Release()
+			}
+			t.sequences = nil
+			t.seqMutex.Unlock()
+		}
+
+		// the jobs that are not stopped by t.stop, such as ShipLog, get an error after it
+		t.swap.Lock()
 		t.db.Close()
 		t.db = nil
+		t.swap.Unlock()
 	}
 }
 
-func (t *DB) Txn(fn func(txn *Txn) error, readOnly ...bool) error {
-	cb := func(tx *bolt.Tx) error {
-		return fn(&Txn{t: tx})
+func (t *DB) now() time.Time {
+	return t.opts.Clock()
+}
+
+// view and update run a bolt transaction, Restore waits for them
+func (t *DB) view(fn func(tx *bolt.Tx) error) error {
+	t.swap.RLock()
+	defer t.swap.RUnlock()
+	if t.db == nil {
+		return bolt.ErrDatabaseNotOpen
+	}
+	return t.db.View(fn)
+}
+
+func (t *DB) update(fn func(tx *bolt.Tx) error) error {
+	t.swap.RLock()
+	defer t.swap.RUnlock()
+	if t.db == nil {
+		return bolt.ErrDatabaseNotOpen
 	}
+	return t.db.Update(fn)
+}
+
+func (t *DB) Txn(fn func(txn *Txn) error, readOnly ...bool) error {
 	if len(readOnly) > 0 && readOnly[0] {
-		return t.db.View(cb)
+		return t.view(func(tx *bolt.Tx) error {
+			return fn(&Txn{t: tx, db: t})
+		})
+	}
+
+	if t.readOnly.Load() {
+		return ErrReadOnly
+	}
+
+	// the batch may run fn more than once, only the last run is committed
+	var txn *Txn
+	err := bolt.ErrDatabaseNotOpen
+	t.swap.RLock()
+	if t.db != nil {
+		err = t.db.Batch(func(tx *bolt.Tx) error {
+			txn = &Txn{t: tx, db: t, record: t.watching(), logging: t.changeLog.Load()}
+			return fn(txn)
+		})
+	}
+	t.swap.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// the events are published out of the lock, so Restore does not wait for the watchers
+	t.publish(txn.events)
+	return nil
+}
+
+// chunks runs fn in a write transaction for each chunk of at most size keys with the prefix after begin,
+// so a long job does not block the writers. fn may update or delete the keys of its chunk,
+// committed is called after the chunk is committed when it is not nil.
+func (t *DB) chunks(prefix, begin string, size int, fn func(txn *Txn, keys []string) error, committed func(keys []string)) error {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	last := begin
+	for {
+		var keys []string
+		err := t.Txn(func(txn *Txn) error {
+			keys = nil
+			err := txn.List(prefix, func(key string, value []byte) (bool, error) {
+				keys = append(keys, key)
+				return false, nil
+			}, &ListOption{Begin: last, Limit: size, KeyOnly: true})
+			if err != nil || len(keys) == 0 {
+				return err
+			}
+			return fn(txn, keys)
+		})
+		if err != nil {
+			return err
+		}
+		if committed != nil && len(keys) > 0 {
+			committed(keys)
+		}
+		if len(keys) < size {
+			return nil
+		}
+		last = keys[len(keys)-1]
 	}
-	return t.db.Batch(cb)
 }
 
 func (t *DB) List(prefix string, fn func(key string, value []byte) (stop bool, err error), options ...*ListOption) error {
@@ -42,3 +199,28 @@ func (t *DB) List(prefix string, fn func(key string, value []byte) (stop bool, e
 		return txn.List(prefix, fn, options...)
 	}, true)
 }
+
+func (t *DB) ListKey(key Key, fn func(key string, value []byte) (stop bool, err error), options ...*ListOption) error {
+	return t.Txn(func(txn *Txn) error {
+		return txn.ListKey(key, fn, options...)
+	}, true)
+}
+
+// ModelNewID generates an id by the generator of the model,
+// a write transaction is only used when the generator requires it
+func (t *DB) ModelNewID(model any) (id string, err error) {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return "", err
+	}
+
+	gen := GetIDGenerator(model)
+	id, err = gen.NextID(nil, modelName)
+	if errors.Is(err, ErrTxnRequired) {
+		err = t.Txn(func(txn *Txn) error {
+			id, err = gen.NextID(txn, modelName)
+			return err
+		})
+	}
+	return
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"io"
+	"strings"
+
+	json "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultLoadBatch = 10000
+
+// the buckets of the change log and the replication, they belong to the file rather than the data
+var logBuckets = map[string]bool{
+	string(logBucket):       true,
+	string(logOffsetBucket): true,
+	string(replicaBucket):   true,
+}
+
+// DumpOptions filters the dumped keys, all buckets except the change log are dumped by default
+type DumpOptions struct {
+	Buckets    []string // Only dump these buckets
+	Prefix     string   // Only dump the keys with the prefix
+	SkipIndex  bool     // Skip the index data in the buckets "_i" and "_ic"
+	IncludeLog bool     // Also dump the change log and the replication state
+}
+
+type LoadOptions struct {
+	Buckets   []string // Only load these buckets
+	Prefix    string   // Only load the keys with the prefix
+	SkipIndex bool     // Skip the index data in the buckets "_i" and "_ic"
+	Rebuild   []any    // Rebuild the indexes of the models after the load, the index data of the dump is skipped
+	BatchSize int      // The number of keys written in one transaction, 10000 by default
+}
+
+// dumpLine is a line of the dump, the value is stored compressed when Compressed is set
+type dumpLine struct {
+	Bucket     string `json:"bucket"`
+	Compressed bool   `json:"compressed,omitempty"`
+	*Record
+}
+
+type keyFilter struct {
+	buckets    map[string]bool
+	prefix     string
+	skipIndex  bool
+	includeLog bool
+}
+
+func newKeyFilter(buckets []string, prefix string, skipIndex, includeLog bool) *keyFilter {
+	f := &keyFilter{prefix: prefix, skipIndex: skipIndex, includeLog: includeLog}
+	if len(buckets) > 0 {
+		f.buckets = map[string]bool{}
+		for _, b := range buckets {
+			f.buckets[b] = true
+		}
+	}
+	return f
+}
+
+func (f *keyFilter) bucket(name string) bool {
+	if f.buckets != nil && !f.buckets[name] {
+		return false
+	}
+	if f.skipIndex && (name == "_i" || name == "_ic") {
+		return false
+	}
+	return f.includeLog || !logBuckets[name]
+}
+
+func (f *keyFilter) key(bucket, key string) bool {
+	return f.bucket(bucket) && strings.HasPrefix(key, f.prefix)
+}
+
+// Dump writes the keys of all buckets as NDJSON in one read transaction, and returns the number of written keys.
+// The values are uncompressed, see Record for the encoding.
+func (t *DB) Dump(w io.Writer, opts *DumpOptions) (n int, err error) {
+	if opts == nil {
+		opts = &DumpOptions{}
+	}
+	filter := newKeyFilter(opts.Buckets, opts.Prefix, opts.SkipIndex, opts.IncludeLog)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	err = t.view(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			bucket := string(name)
+			if !filter.bucket(bucket) {
+				return nil
+			}
+
+			c := b.Cursor()
+			prefix := []byte(opts.Prefix)
+			for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), opts.Prefix); k, v = c.Next() {
+				value, compressed := uncompress(v)
+				line := dumpLine{Bucket: bucket, Compressed: compressed, Record: newRecord(string(k), value)}
+				if err := encoder.Encode(line); err != nil {
+					return err
+				}
+				n++
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// Load writes the keys of a dump in batched transactions, and returns the number of written keys.
+// The existing keys are overwritten, the keys that are not in the dump are kept.
+func (t *DB) Load(r io.Reader, opts *LoadOptions) (n int, err error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	if t.readOnly.Load() {
+		return 0, ErrReadOnly
+	}
+	size := opts.BatchSize
+	if size <= 0 {
+		size = defaultLoadBatch
+	}
+	filter := newKeyFilter(opts.Buckets, opts.Prefix, opts.SkipIndex || len(opts.Rebuild) > 0, true)
+
+	decoder := json.NewDecoder(r)
+	var batch []dumpLine
+	for line := 1; ; line++ {
+		var l dumpLine
+		err := decoder.Decode(&l)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return n, errors.Wrapf(err, "line: %d", line)
+		}
+		if l.Record == nil {
+			return n, errors.Errorf("line: %d, missing key", line)
+		}
+		key, err := l.RawKey()
+		if err != nil {
+			return n, errors.Wrapf(err, "line: %d", line)
+		}
+		if !filter.key(l.Bucket, key) {
+			continue
+		}
+
+		batch = append(batch, l)
+		if len(batch) < size {
+			continue
+		}
+		if err := t.load(batch); err != nil {
+			return n, err
+		}
+		n += len(batch)
+		batch = batch[:0]
+	}
+
+	if len(batch) > 0 {
+		if err := t.load(batch); err != nil {
+			return n, err
+		}
+		n += len(batch)
+	}
+
+	for _, model := range opts.Rebuild {
+		if err := t.RebuildAllIndexes(model, nil); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (t *DB) load(lines []dumpLine) error {
+	return t.Txn(func(txn *Txn) error {
+		for _, l := range lines {
+			key, _ := l.RawKey()
+			value, err := l.Bytes()
+			if err != nil {
+				return errors.Wrapf(err, "key: %s", key)
+			}
+			if value == nil {
+				value = []byte{}
+			}
+			if l.Compressed {
+				if value, err = GzipCompress(value); err != nil {
+					return err
+				}
+			}
+
+			// the keys of the data are written like Set, so they are logged and watched
+			if GetBucket(key) == l.Bucket {
+				if err := txn.put(key, value); err != nil {
+					return err
+				}
+				continue
+			}
+			b, err := txn.t.CreateBucketIfNotExists([]byte(l.Bucket))
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
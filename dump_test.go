@@ -0,0 +1,93 @@
+package db
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type dumpUser struct {
+	Name string `db:"index"`
+	Tags []string
+}
+
+func TestDumpLoad(t *testing.T) {
+	dir := t.TempDir()
+	src, err := Open(filepath.Join(dir, "src"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	err = src.Txn(func(txn *Txn) error {
+		if err := txn.ModelSet(&dumpUser{Name: "alice"}, 1); err != nil {
+			return err
+		}
+		if err := txn.ModelSet(&dumpUser{Name: "bob", Tags: []string{strings.Repeat("x", 200)}}, 2); err != nil {
+			return err
+		}
+		if err := txn.Set("raw:bin", []byte{0xff, 0x00, 0x01}); err != nil {
+			return err
+		}
+		return txn.Set("raw:text", "hello")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dump bytes.Buffer
+	n, err := src.Dump(&dump, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 || !strings.Contains(dump.String(), `"key":"raw:text","type":"text","value":"hello"`) {
+		t.Fatalf("unexpected dump: %s", dump.String())
+	}
+
+	// the index data is skipped and rebuilt from the models
+	dst, err := Open(filepath.Join(dir, "dst"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	loaded, err := dst.Load(bytes.NewReader(dump.Bytes()), &LoadOptions{Rebuild: []any{&dumpUser{}}, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded == 0 || loaded >= n {
+		t.Errorf("expected the index data to be skipped, dumped %d, loaded %d", n, loaded)
+	}
+
+	err = dst.Txn(func(txn *Txn) error {
+		if v, err := txn.Get("raw:bin"); err != nil || !bytes.Equal(v, []byte{0xff, 0x00, 0x01}) {
+			t.Errorf("unexpected value: %v, %v", v, err)
+		}
+		m, err := txn.ModelGet(&dumpUser{}, 2)
+		if err != nil {
+			return err
+		}
+		if u := m.(*dumpUser); u.Name != "bob" || len(u.Tags) != 1 {
+			t.Errorf("unexpected model: %+v", u)
+		}
+		if ids, _ := txn.IndexList(&dumpUser{}, "Name", "alice"); len(ids) != 1 || ids[0] != "1" {
+			t.Errorf("unexpected index: %v", ids)
+		}
+		if c := txn.IndexCount(&dumpUser{}, "Name", "bob"); c != 1 {
+			t.Errorf("expected index count 1 but got %d", c)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a second dump has the same lines
+	var again bytes.Buffer
+	if _, err := dst.Dump(&again, &DumpOptions{Prefix: "raw:"}); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(again.String(), "\n"); lines != 2 {
+		t.Errorf("expected 2 lines but got %d: %s", lines, again.String())
+	}
+}
@@ -4,4 +4,6 @@ import "errors"
 
 var (
 	ErrKeyNotFound = errors.New("key not found")
+	ErrReadOnly    = errors.New("the database is read-only")
+	ErrInvalidDB   = errors.New("invalid database file")
 )
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// HistoryPolicy enables the history of a registered model, see ModelOptions.
+// The latest revision is always kept.
+type HistoryPolicy struct {
+	MaxRevisions int           // The maximum number of revisions of a model, 0 keeps them
+	MaxAge       time.Duration // The revisions older than it are removed, 0 keeps them
+}
+
+// Revision is a stored state of a model
+type Revision struct {
+	Revision uint64
+	Time     time.Time
+	Deleted  bool // the model was deleted
+	Model    any  // the model of the revision, nil when it was deleted
+}
+
+// historyEntry is stored in the bucket "_history", the latest revision has the document,
+// the older ones have the changes turning the document of the next revision into theirs.
+type historyEntry struct {
+	Time    int64           `json:"t"`
+	Deleted bool            `json:"d,omitempty"`
+	Doc     json.RawMessage `json:"doc,omitempty"`
+	Patch   *historyPatch   `json:"patch,omitempty"`
+}
+
+// historyPatch has the changed top-level fields of a document
+type historyPatch struct {
+	Deleted bool                       `json:"d,omitempty"` // the revision was deleted
+	Set     map[string]json.RawMessage `json:"set,omitempty"`
+	Del     []string                   `json:"del,omitempty"`
+}
+
+func historyPrefix(modelName string, id any) string {
+	return fmt.Sprintf("_history:%s:%v:", modelName, id)
+}
+
+func historyKey(modelName string, id any, revision uint64) string {
+	return fmt.Sprintf("%s%020d", historyPrefix(modelName, id), revision)
+}
+
+// historyPolicy returns the history policy of the registered model
+func historyPolicy(model any) *HistoryPolicy {
+	if t := modelType(model); t != nil {
+		if info := registeredModel(t); info != nil {
+			return info.opts.History
+		}
+	}
+	return nil
+}
+
+// diffDocs returns the patch turning the document from into the document to
+func diffDocs(from, to json.RawMessage) (*historyPatch, error) {
+	var a, b map[string]json.RawMessage
+	if len(from) > 0 {
+		if err := json.Unmarshal(from, &a); err != nil {
+			return nil, err
+		}
+	}
+	if len(to) > 0 {
+		if err := json.Unmarshal(to, &b); err != nil {
+			return nil, err
+		}
+	}
+	patch := &historyPatch{Set: map[string]json.RawMessage{}}
+	for k, v := range b {
+		if old, ok := a[k]; !ok || string(old) != string(v) {
+			patch.Set[k] = v
+		}
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			patch.Del = append(patch.Del, k)
+		}
+	}
+	return patch, nil
+}
+
+func applyPatch(doc json.RawMessage, patch *historyPatch) (json.RawMessage, error) {
+	m := map[string]json.RawMessage{}
+	if len(doc) > 0 {
+		if err := json.Unmarshal(doc, &m); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range patch.Set {
+		m[k] = v
+	}
+	for _, k := range patch.Del {
+		delete(m, k)
+	}
+	return json.Marshal(m)
+}
+
+// historyEntries returns the revisions and the entries of the model, from the oldest or in the order of the options
+func (txn *Txn) historyEntries(modelName string, id any, options ...*ListOption) (revisions []uint64, entries []*historyEntry, err error) {
+	prefix := historyPrefix(modelName, id)
+	err = txn.List(prefix, func(key string, value []byte) (bool, error) {
+		revision, err := strconv.ParseUint(strings.TrimPrefix(key, prefix), 10, 64)
+		if err != nil {
+			return true, errors.Wrapf(err, "history key: %s", key)
+		}
+		entry := &historyEntry{}
+		if err := json.Unmarshal(value, entry); err != nil {
+			return true, errors.Wrapf(err, "history key: %s", key)
+		}
+		revisions = append(revisions, revision)
+		entries = append(entries, entry)
+		return false, nil
+	}, options...)
+	return
+}
+
+// historyDocs rebuilds the documents of the entries from the latest, the deleted revisions have no document
+func historyDocs(entries []*historyEntry) ([]json.RawMessage, error) {
+	docs := make([]json.RawMessage, len(entries))
+	var next json.RawMessage
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		var doc json.RawMessage
+		switch {
+		case entry.Patch != nil:
+			var err error
+			if doc, err = applyPatch(next, entry.Patch); err != nil {
+				return nil, err
+			}
+		default:
+			doc = entry.Doc
+		}
+		// a deleted revision keeps the document before it for the patches
+		next = doc
+		if !entry.Deleted {
+			docs[i] = doc
+		}
+	}
+	return docs, nil
+}
+
+// recordHistory adds a revision of the saved or deleted model when its history is enabled
+func (txn *Txn) recordHistory(modelName string, id, model any, deleted bool) error {
+	policy := historyPolicy(model)
+	if policy == nil {
+		return nil
+	}
+	var doc json.RawMessage
+	if !deleted {
+		doc = ToBytes(model)
+	}
+
+	// only the last entry is read, the older ones are patches already
+	revisions, entries, err := txn.historyEntries(modelName, id, &ListOption{Reverse: true, Limit: 1})
+	if err != nil {
+		return err
+	}
+	entry := &historyEntry{Time: txn.now().UnixNano(), Deleted: deleted, Doc: doc}
+	var revision uint64 = 1
+	if len(entries) > 0 {
+		last := entries[0]
+		revision = revisions[0] + 1
+		if entry.Deleted {
+			// the deleted revision keeps the last document
+			entry.Doc = last.Doc
+		}
+		if last.Patch == nil {
+			// the last document is replaced by its changes
+			patch, err := diffDocs(entry.Doc, last.Doc)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set(historyKey(modelName, id, revisions[0]), &historyEntry{Time: last.Time, Deleted: last.Deleted, Patch: patch}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := txn.Set(historyKey(modelName, id, revision), entry); err != nil {
+		return err
+	}
+	return txn.trimHistory(modelName, id, revision, policy)
+}
+
+// trimHistory removes the oldest revisions beyond the policy, the scan stops at the first kept one.
+// The revisions of a model are consecutive, only the oldest ones are removed.
+func (txn *Txn) trimHistory(modelName string, id any, latest uint64, policy *HistoryPolicy) error {
+	if policy.MaxRevisions <= 0 && policy.MaxAge <= 0 {
+		return nil
+	}
+	minTime := int64(0)
+	if policy.MaxAge > 0 {
+		minTime = txn.now().Add(-policy.MaxAge).UnixNano()
+	}
+
+	var expired []string
+	prefix := historyPrefix(modelName, id)
+	err := txn.List(prefix, func(key string, value []byte) (bool, error) {
+		revision, err := strconv.ParseUint(strings.TrimPrefix(key, prefix), 10, 64)
+		if err != nil {
+			return true, errors.Wrapf(err, "history key: %s", key)
+		}
+		if revision >= latest {
+			return true, nil
+		}
+		tooMany := policy.MaxRevisions > 0 && latest-revision >= uint64(policy.MaxRevisions)
+		if !tooMany {
+			if minTime == 0 {
+				return true, nil
+			}
+			entry := &historyEntry{}
+			if err := json.Unmarshal(value, entry); err != nil {
+				return true, errors.Wrapf(err, "history key: %s", key)
+			}
+			if entry.Time >= minTime {
+				return true, nil
+			}
+		}
+		expired = append(expired, key)
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err := txn.Del(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearHistory removes the revisions of the model
+func (txn *Txn) clearHistory(modelName string, id any) error {
+	revisions, _, err := txn.historyEntries(modelName, id)
+	if err != nil {
+		return err
+	}
+	for _, revision := range revisions {
+		if err := txn.Del(historyKey(modelName, id, revision)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ModelHistory returns the revisions of the model from the oldest, see HistoryPolicy
+func (txn *Txn) ModelHistory(model, id any) ([]*Revision, error) {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" || NewModel(model) == nil {
+		return nil, err
+	}
+	_, id = txn.modelKey(modelName, id)
+
+	revisions, entries, err := txn.historyEntries(modelName, id)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := historyDocs(entries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "history, model: %s, id: %v", modelName, id)
+	}
+
+	list := make([]*Revision, len(entries))
+	for i, entry := range entries {
+		r := &Revision{Revision: revisions[i], Time: time.Unix(0, entry.Time), Deleted: entry.Deleted}
+		if docs[i] != nil {
+			m := NewModel(model)
+			if _, err := decodeModel(docs[i], m); err != nil {
+				return nil, errors.Wrapf(err, "history, model: %s, id: %v, revision: %d", modelName, id, revisions[i])
+			}
+			r.Model = m
+		}
+		list[i] = r
+	}
+	return list, nil
+}
+
+// ModelGetAt returns the model as it was at the time by its history
+func (txn *Txn) ModelGetAt(model, id any, at time.Time) (any, error) {
+	list, err := txn.ModelHistory(model, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Time.After(at) {
+			continue
+		}
+		if list[i].Deleted {
+			break
+		}
+		return list[i].Model, nil
+	}
+	return nil, errors.Wrapf(ErrKeyNotFound, "history, id: %v, time: %s", id, at)
+}
+
+// ModelRevert saves the model of the revision, which adds a new revision
+func (txn *Txn) ModelRevert(model, id any, revision uint64) error {
+	list, err := txn.ModelHistory(model, id)
+	if err != nil {
+		return err
+	}
+	for _, r := range list {
+		if r.Revision != revision {
+			continue
+		}
+		if r.Deleted {
+			return errors.Wrapf(ErrRevisionNotFound, "the model is deleted in the revision, id: %v, revision: %d", id, revision)
+		}
+		return txn.ModelSet(r.Model, id)
+	}
+	return errors.Wrapf(ErrRevisionNotFound, "id: %v, revision: %d", id, revision)
+}
+
+// moveHistory moves the revisions of the model to another id
+func (txn *Txn) moveHistory(modelName string, from, to any) error {
+	revisions, _, err := txn.historyEntries(modelName, from)
+	if err != nil {
+		return err
+	}
+	for _, revision := range revisions {
+		if err := moveKey(txn, historyKey(modelName, from, revision), historyKey(modelName, to, revision)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type historyPage struct {
+	Title string
+	Body  string
+	Tags  []string `json:",omitempty"`
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	db, err := Open(filepath.Join(t.TempDir(), "db"), &Options{Clock: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := Register[historyPage]("history_page", &ModelOptions{History: &HistoryPolicy{MaxRevisions: 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := now
+	pages := []*historyPage{
+		{Title: "a", Body: "first", Tags: []string{"x"}},
+		{Title: "b", Body: "first"},
+		{Title: "c", Body: "second"},
+		{Title: "d", Body: "second"},
+	}
+	for _, p := range pages {
+		err = db.Txn(func(txn *Txn) error {
+			return txn.ModelSet(p, 1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		list, err := txn.ModelHistory(&historyPage{}, 1)
+		if err != nil {
+			return err
+		}
+		// the oldest revision is removed by the retention
+		if len(list) != 3 || list[0].Revision != 2 || list[2].Revision != 4 {
+			t.Fatalf("unexpected history: %+v", list)
+		}
+		for i, r := range list {
+			if p := r.Model.(*historyPage); p.Title != pages[i+1].Title || p.Body != pages[i+1].Body || len(p.Tags) != 0 {
+				t.Errorf("unexpected revision %d: %+v", r.Revision, p)
+			}
+		}
+
+		m, err := txn.ModelGetAt(&historyPage{}, 1, start.Add(90*time.Second))
+		if err != nil {
+			return err
+		}
+		if m.(*historyPage).Title != "b" {
+			t.Errorf("unexpected model: %+v", m)
+		}
+		if _, err := txn.ModelGetAt(&historyPage{}, 1, start); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("expected ErrKeyNotFound but got %v", err)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.ModelRevert(&historyPage{}, 1, 3); err != nil {
+			return err
+		}
+		if err := txn.ModelRevert(&historyPage{}, 1, 1); !errors.Is(err, ErrRevisionNotFound) {
+			t.Errorf("expected ErrRevisionNotFound but got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Minute)
+	deletedAt := now
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelDel(&historyPage{}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		list, err := txn.ModelHistory(&historyPage{}, 1)
+		if err != nil {
+			return err
+		}
+		if len(list) != 3 || list[1].Model.(*historyPage).Title != "c" || !list[2].Deleted {
+			t.Fatalf("unexpected history: %+v", list)
+		}
+		if _, err := txn.ModelGetAt(&historyPage{}, 1, deletedAt); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("expected ErrKeyNotFound but got %v", err)
+		}
+		if m, err := txn.ModelGetAt(&historyPage{}, 1, deletedAt.Add(-time.Second)); err != nil || m.(*historyPage).Title != "c" {
+			t.Errorf("unexpected model: %+v, %v", m, err)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type historyNote struct {
+	Text string
+}
+
+func TestHistoryMaxAge(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	db, err := Open(filepath.Join(t.TempDir(), "db"), &Options{Clock: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := Register[historyNote]("history_note", &ModelOptions{History: &HistoryPolicy{MaxAge: time.Hour}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"a", "b", "c", "d"} {
+		err = db.Txn(func(txn *Txn) error {
+			return txn.ModelSet(&historyNote{Text: text}, 1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(25 * time.Minute)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		list, err := txn.ModelHistory(&historyNote{}, 1)
+		if err != nil {
+			return err
+		}
+		// "a" is older than an hour when "d" is saved
+		if len(list) != 3 || list[0].Model.(*historyNote).Text != "b" || list[2].Model.(*historyNote).Text != "d" {
+			t.Fatalf("unexpected history: %+v", list)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The optional interfaces of the models called by the model functions.
+// An error returned by a Before hook aborts the write, the errors of the others abort the transaction.
+type (
+	BeforeSaver   interface{ BeforeSave(txn *Txn) error }
+	AfterSaver    interface{ AfterSave(txn *Txn) error }
+	BeforeDeleter interface{ BeforeDelete(txn *Txn) error }
+	AfterDeleter  interface{ AfterDelete(txn *Txn) error }
+	AfterLoader   interface{ AfterLoad() error }
+)
+
+type HookEvent int
+
+const (
+	HookBeforeSave HookEvent = iota + 1
+	HookAfterSave
+	HookBeforeDelete
+	HookAfterDelete
+	HookAfterLoad
+)
+
+func (e HookEvent) String() string {
+	switch e {
+	case HookBeforeSave:
+		return "before save"
+	case HookAfterSave:
+		return "after save"
+	case HookBeforeDelete:
+		return "before delete"
+	case HookAfterDelete:
+		return "after delete"
+	case HookAfterLoad:
+		return "after load"
+	}
+	return "unknown"
+}
+
+// Hook is called for every model, the model is a pointer to the struct
+type Hook func(txn *Txn, modelName string, model any) error
+
+type hooks struct {
+	mu   sync.RWMutex
+	list map[HookEvent][]Hook
+}
+
+// AddHook adds a hook called for all models after the methods of the model and the hooks of the registry.
+// The hooks run inside the transaction, which may be run again when it fails, so they should not have side effects outside it.
+func (t *DB) AddHook(event HookEvent, hook Hook) {
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	if t.hooks.list == nil {
+		t.hooks.list = map[HookEvent][]Hook{}
+	}
+	t.hooks.list[event] = append(t.hooks.list[event], hook)
+}
+
+// runHooks calls the method of the model, the hooks of the registry and the hooks of the database
+func (txn *Txn) runHooks(event HookEvent, modelName string, model any) error {
+	var err error
+	switch event {
+	case HookBeforeSave:
+		if m, ok := model.(BeforeSaver); ok {
+			err = m.BeforeSave(txn)
+		}
+	case HookAfterSave:
+		if m, ok := model.(AfterSaver); ok {
+			err = m.AfterSave(txn)
+		}
+	case HookBeforeDelete:
+		if m, ok := model.(BeforeDeleter); ok {
+			err = m.BeforeDelete(txn)
+		}
+	case HookAfterDelete:
+		if m, ok := model.(AfterDeleter); ok {
+			err = m.AfterDelete(txn)
+		}
+	case HookAfterLoad:
+		if m, ok := model.(AfterLoader); ok {
+			err = m.AfterLoad()
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "%s hook, model: %s", event, modelName)
+	}
+
+	var list []Hook
+	if t := modelType(model); t != nil {
+		if info := registeredModel(t); info != nil {
+			list = append(list, info.opts.Hooks[event]...)
+		}
+	}
+	if txn.db != nil {
+		txn.db.hooks.mu.RLock()
+		list = append(list, txn.db.hooks.list[event]...)
+		txn.db.hooks.mu.RUnlock()
+	}
+	for _, hook := range list {
+		if err := hook(txn, modelName, model); err != nil {
+			return errors.Wrapf(err, "%s hook, model: %s", event, modelName)
+		}
+	}
+	return nil
+}
+
+// afterLoad completes a loaded model
+func (txn *Txn) afterLoad(key, modelName string, model any) error {
+	txn.loadVersion(key, model)
+	return txn.runHooks(HookAfterLoad, modelName, model)
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+var errHookRejected = errors.New("rejected")
+
+type hookNote struct {
+	Text   string
+	Loaded bool `json:"-"`
+	saves  int
+}
+
+func (n *hookNote) BeforeSave(txn *Txn) error {
+	if n.Text == "" {
+		return errHookRejected
+	}
+	n.saves++
+	return nil
+}
+
+func (n *hookNote) AfterLoad() error {
+	n.Loaded = true
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var events []HookEvent
+	for _, event := range []HookEvent{HookAfterSave, HookBeforeDelete, HookAfterDelete} {
+		event := event
+		db.AddHook(event, func(txn *Txn, modelName string, model any) error {
+			if modelName != "hook_note" {
+				t.Errorf("unexpected model name: %s", modelName)
+			}
+			events = append(events, event)
+			return nil
+		})
+	}
+
+	note := &hookNote{Text: "a"}
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSet(note, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.saves != 1 || len(events) != 1 || events[0] != HookAfterSave {
+		t.Errorf("unexpected hooks, saves: %d, events: %v", note.saves, events)
+	}
+
+	// an error of a before hook aborts the transaction
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.ModelSet(&hookNote{Text: "b"}, 2); err != nil {
+			return err
+		}
+		return txn.ModelSet(&hookNote{}, 3)
+	})
+	if !errors.Is(err, errHookRejected) {
+		t.Fatalf("expected errHookRejected but got %v", err)
+	}
+	// a failed batch is run again, the hooks of the rolled back runs are ignored
+	events = nil
+
+	err = db.Txn(func(txn *Txn) error {
+		if txn.Has("hook_note:2") {
+			t.Error("expected the transaction to be rolled back")
+		}
+		m, err := txn.ModelGet(&hookNote{}, 1)
+		if err != nil {
+			return err
+		}
+		if !m.(*hookNote).Loaded {
+			t.Error("expected AfterLoad to be called")
+		}
+		list, err := txn.ModelList(&hookNote{}, 0, "", false)
+		if err != nil {
+			return err
+		}
+		if len(list) != 1 || !list[0].(*hookNote).Loaded {
+			t.Errorf("unexpected list: %v", list)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelDel(&hookNote{}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HookEvent{HookBeforeDelete, HookAfterDelete}
+	if len(events) != len(want) {
+		t.Fatalf("unexpected events: %v", events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("unexpected events: %v", events)
+		}
+	}
+}
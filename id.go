@@ -0,0 +1,40 @@
+package db
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidID = errors.New("invalid id")
+
+// SortableID encodes a non-negative number as a string that sorts in numeric order.
+// The first letter is the number of digits ('a' for 1 digit, 'b' for 2 ...), e.g. 42 -> "b42".
+func SortableID(n int64) string {
+	if n < 0 {
+		n = 0
+	}
+	digits := strconv.FormatInt(n, 10)
+	return string(rune('a'+len(digits)-1)) + digits
+}
+
+func ParseSortableID(id string) (int64, error) {
+	if len(id) < 2 || id[0] < 'a' || int(id[0]-'a'+1) != len(id)-1 || (len(id) > 2 && id[1] == '0') {
+		return 0, errors.Wrapf(ErrInvalidID, "id: %s", id)
+	}
+	for _, c := range id[1:] {
+		if c < '0' || c > '9' {
+			return 0, errors.Wrapf(ErrInvalidID, "id: %s", id)
+		}
+	}
+	return strconv.ParseInt(id[1:], 10, 64)
+}
+
+// FormatID returns the human-readable form of an id, sortable ids are rendered as plain numbers
+func FormatID(id string) string {
+	n, err := ParseSortableID(id)
+	if err != nil {
+		return id
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,339 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrTxnRequired     = errors.New("the id generator requires a write transaction")
+	ErrInvalidTemplate = errors.New("invalid id template")
+)
+
+// IDGenerator generates the ids of a model, txn is nil when the id is generated outside a transaction
+type IDGenerator interface {
+	NextID(txn *Txn, modelName string) (string, error)
+}
+
+var (
+	generatorMutex    sync.RWMutex
+	namedGenerators   = map[string]IDGenerator{}
+	modelIDGenerators = map[string]IDGenerator{}
+)
+
+func init() {
+	RegisterIDGenerator("counter", NewCounterID(0))
+	RegisterIDGenerator("ulid", NewULID())
+	RegisterIDGenerator("uuidv7", NewUUIDv7())
+	snowflake, _ := NewSnowflake(0)
+	RegisterIDGenerator("snowflake", snowflake)
+}
+
+// RegisterIDGenerator registers a generator by name, so a model can choose it by tag: `db:"id=ulid"`
+func RegisterIDGenerator(name string, gen IDGenerator) {
+	generatorMutex.Lock()
+	defer generatorMutex.Unlock()
+	namedGenerators[name] = gen
+}
+
+// SetIDGenerator sets the generator of a model, it takes precedence over the tag
+func SetIDGenerator(model any, gen IDGenerator) {
+	if modelName := modelNameOrEmpty(model); modelName != "" {
+		setIDGenerator(modelName, gen)
+	}
+}
+
+func setIDGenerator(modelName string, gen IDGenerator) {
+	generatorMutex.Lock()
+	defer generatorMutex.Unlock()
+	if gen == nil {
+		delete(modelIDGenerators, modelName)
+		return
+	}
+	modelIDGenerators[modelName] = gen
+}
+
+// GetIDGenerator returns the generator of the model: set by SetIDGenerator, chosen by tag or the counter
+func GetIDGenerator(model any) IDGenerator {
+	generatorMutex.RLock()
+	defer generatorMutex.RUnlock()
+
+	if gen, ok := modelIDGenerators[modelNameOrEmpty(model)]; ok {
+		return gen
+	}
+	if name := idGeneratorTag(model); name != "" {
+		if gen, ok := namedGenerators[name]; ok {
+			return gen
+		}
+	}
+	return namedGenerators["counter"]
+}
+
+// the generator name of the first field with the tag `db:"id=name"`
+func idGeneratorTag(model any) string {
+	modelType := reflect.TypeOf(model)
+	for modelType != nil && modelType.Kind() == reflect.Pointer {
+		modelType = modelType.Elem()
+	}
+	if modelType == nil || modelType.Kind() != reflect.Struct {
+		return ""
+	}
+
+	for i := 0; i < modelType.NumField(); i++ {
+		tag := modelType.Field(i).Tag.Get(tagName)
+		for _, v := range strings.Split(strings.Trim(tag, ", ;"), ",") {
+			name, val, ok := strings.Cut(v, "=")
+			if ok && strings.TrimSpace(name) == "id" {
+				return strings.TrimSpace(val)
+			}
+		}
+	}
+	return ""
+}
+
+// CounterID generates ids by ModelNextID.
+// When length is 0, the length of the model is used, and a new model uses sortable ids.
+type CounterID struct {
+	Length int
+}
+
+func NewCounterID(length int) IDGenerator {
+	return &CounterID{Length: length}
+}
+
+func (g *CounterID) NextID(txn *Txn, modelName string) (string, error) {
+	if txn == nil {
+		return "", ErrTxnRequired
+	}
+
+	length := g.Length
+	if length == 0 {
+		length = txn.modelIDLength(modelName)
+	}
+	if err := txn.markSortableID(modelName, length); err != nil {
+		return "", err
+	}
+	return txn.modelNextID(modelName, length), nil
+}
+
+// markSortableID gives a new model without an id length sortable ids, the numbers of the old models are kept
+func (txn *Txn) markSortableID(modelName string, length int) error {
+	if length == 0 && !txn.hasSortableID(modelName) && txn.modelCounter(modelName) == 0 && txn.modelTotal(modelName) == 0 {
+		return txn.Set(fmt.Sprintf("_id_fmt:%s", modelName), sortableIDFormat)
+	}
+	return nil
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates lexicographically sortable ids, ids generated in the same millisecond are monotonic
+type ULID struct {
+	mu     sync.Mutex
+	lastMs uint64
+	random [10]byte
+}
+
+func NewULID() IDGenerator {
+	return &ULID{}
+}
+
+func (g *ULID) NextID(txn *Txn, modelName string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms > g.lastMs {
+		if _, err := rand.Read(g.random[:]); err != nil {
+			return "", err
+		}
+		g.lastMs = ms
+	} else {
+		// increase the random part, borrow the next millisecond when it overflows
+		i := len(g.random) - 1
+		for ; i >= 0; i-- {
+			g.random[i]++
+			if g.random[i] != 0 {
+				break
+			}
+		}
+		if i < 0 {
+			g.lastMs++
+		}
+	}
+
+	var data [16]byte
+	binary.BigEndian.PutUint16(data[0:2], uint16(g.lastMs>>32))
+	binary.BigEndian.PutUint32(data[2:6], uint32(g.lastMs))
+	copy(data[6:], g.random[:])
+
+	// 128 bits are encoded as 26 characters, the first character has 2 leading zero bits
+	bit := func(pos int) byte {
+		pos -= 2
+		if pos < 0 {
+			return 0
+		}
+		return (data[pos/8] >> (7 - pos%8)) & 1
+	}
+	out := make([]byte, 26)
+	for i := range out {
+		var c byte
+		for j := 0; j < 5; j++ {
+			c = c<<1 | bit(i*5+j)
+		}
+		out[i] = crockford[c]
+	}
+	return string(out), nil
+}
+
+// UUIDv7 generates time-ordered uuids, the 12 bits of rand_a are used as a counter in the same millisecond
+type UUIDv7 struct {
+	mu     sync.Mutex
+	lastMs uint64
+	seq    uint16
+}
+
+func NewUUIDv7() IDGenerator {
+	return &UUIDv7{}
+}
+
+func (g *UUIDv7) NextID(txn *Txn, modelName string) (string, error) {
+	g.mu.Lock()
+	ms := uint64(time.Now().UnixMilli())
+	if ms > g.lastMs {
+		g.lastMs = ms
+		g.seq = 0
+	} else {
+		g.seq++
+		if g.seq > 0xfff {
+			g.lastMs++
+			g.seq = 0
+		}
+	}
+	ms, seq := g.lastMs, g.seq
+	g.mu.Unlock()
+
+	var data [16]byte
+	if _, err := rand.Read(data[8:]); err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint16(data[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(data[2:6], uint32(ms))
+	binary.BigEndian.PutUint16(data[6:8], 0x7000|seq)
+	data[8] = data[8]&0x3f | 0x80
+
+	text := hex.EncodeToString(data[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", text[0:8], text[8:12], text[12:16], text[16:20], text[20:]), nil
+}
+
+// 2020-01-01 00:00:00 UTC
+const snowflakeEpoch = 1577836800000
+
+// Snowflake generates 63-bit ids: 41 bits of milliseconds, 10 bits of node and 12 bits of sequence.
+// Ids are padded to 19 digits so they sort as strings.
+type Snowflake struct {
+	mu     sync.Mutex
+	node   int64
+	lastMs int64
+	seq    int64
+}
+
+func NewSnowflake(node int64) (IDGenerator, error) {
+	if node < 0 || node > 1023 {
+		return nil, errors.Errorf("snowflake node must be between 0 and 1023, got %d", node)
+	}
+	return &Snowflake{node: node}, nil
+}
+
+func (g *Snowflake) NextID(txn *Txn, modelName string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// the last millisecond is reused when the clock goes backwards
+	ms := time.Now().UnixMilli() - snowflakeEpoch
+	if ms > g.lastMs {
+		g.lastMs = ms
+		g.seq = 0
+	} else {
+		g.seq++
+		if g.seq > 0xfff {
+			g.lastMs++
+			g.seq = 0
+		}
+	}
+
+	id := g.lastMs<<22 | g.node<<12 | g.seq
+	return PaddingZero(id, 19), nil
+}
+
+var templatePattern = regexp.MustCompile(`\{(yyyy|yy|mm|dd|hh|seq(?::(\d+))?)\}`)
+
+// TemplateID generates ids from a template such as "INV-{yyyy}-{seq:5}".
+// The placeholders are {yyyy} {yy} {mm} {dd} {hh} and {seq:width},
+// the sequence resets when the rendered date part changes.
+type TemplateID struct {
+	Template string
+	Now      func() time.Time
+}
+
+func NewTemplateID(template string) (IDGenerator, error) {
+	n := 0
+	for _, m := range templatePattern.FindAllStringSubmatch(template, -1) {
+		if strings.HasPrefix(m[1], "seq") {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, errors.Wrapf(ErrInvalidTemplate, "template must contain one {seq}: %s", template)
+	}
+	return &TemplateID{Template: template}, nil
+}
+
+func (g *TemplateID) NextID(txn *Txn, modelName string) (string, error) {
+	if txn == nil {
+		return "", ErrTxnRequired
+	}
+
+	now := txn.now()
+	if g.Now != nil {
+		now = g.Now()
+	}
+
+	render := func(seq int64) string {
+		return templatePattern.ReplaceAllStringFunc(g.Template, func(s string) string {
+			m := templatePattern.FindStringSubmatch(s)
+			switch m[1] {
+			case "yyyy":
+				return now.Format("2006")
+			case "yy":
+				return now.Format("06")
+			case "mm":
+				return now.Format("01")
+			case "dd":
+				return now.Format("02")
+			case "hh":
+				return now.Format("15")
+			}
+			if seq < 0 {
+				return ""
+			}
+			width, _ := strconv.Atoi(m[2])
+			return PaddingZero(seq, width)
+		})
+	}
+
+	seq, err := txn.CounterAdd(fmt.Sprintf("_seq:%s:%s", modelName, render(-1)), 1)
+	if err != nil {
+		return "", err
+	}
+	return render(seq), nil
+}
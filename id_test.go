@@ -0,0 +1,306 @@
+package db
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSortableID(t *testing.T) {
+	var ids []string
+	for _, n := range []int64{0, 1, 9, 10, 99, 100, 12345, 1 << 40} {
+		id := SortableID(n)
+		ids = append(ids, id)
+
+		parsed, err := ParseSortableID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed != n {
+			t.Errorf("expected '%v' but got '%v'", n, parsed)
+		}
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatalf("ids are not sorted: %v", ids)
+	}
+
+	if FormatID("c123") != "123" || FormatID("00123") != "00123" {
+		t.Error("unexpected FormatID")
+	}
+
+	for _, id := range []string{"", "a", "b1", "b01", "c1x3", "123"} {
+		if _, err := ParseSortableID(id); err == nil {
+			t.Errorf("expected error for '%s'", id)
+		}
+	}
+}
+
+func TestModelSortableID(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type Invoice struct {
+		Number string `db:"index"`
+	}
+
+	// the padding overflows after 9 ids
+	err = db.Txn(func(txn *Txn) error {
+		for i := 0; i < 12; i++ {
+			id := txn.ModelNextID(&Invoice{}, 1)
+			if err := txn.ModelSet(&Invoice{Number: id}, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ModelMigrateSortableID(&Invoice{}, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		id := txn.ModelNextID(&Invoice{}, 1)
+		if id != "b13" {
+			t.Errorf("unexpected next id: %s", id)
+		}
+		if err := txn.ModelSet(&Invoice{Number: FormatID(id)}, id); err != nil {
+			return err
+		}
+
+		list, err := txn.ModelList(&Invoice{}, 3, "", true)
+		if err != nil {
+			return err
+		}
+		var numbers []string
+		for _, v := range ToEntities[*Invoice](list) {
+			numbers = append(numbers, v.Number)
+		}
+		if len(numbers) != 3 || numbers[0] != "13" || numbers[1] != "12" || numbers[2] != "11" {
+			t.Errorf("unexpected list: %v", numbers)
+		}
+
+		// the human-readable id can be used to read the model
+		m, err := txn.ModelGet(&Invoice{}, "10")
+		if err != nil {
+			return err
+		}
+		if ToEntity[*Invoice](m).Number != "10" {
+			t.Errorf("unexpected model: %+v", m)
+		}
+
+		ids, err := txn.IndexList(&Invoice{}, "number", "10")
+		if err != nil {
+			return err
+		}
+		if len(ids) != 1 || ids[0] != "b10" {
+			t.Errorf("unexpected index: %v", ids)
+		}
+
+		if total := txn.ModelTotal(&Invoice{}); total != 13 {
+			t.Errorf("unexpected total: %d", total)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestModelSortableIDCollision(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type Receipt struct {
+		Number string
+	}
+	err = db.Txn(func(txn *Txn) error {
+		for _, id := range []string{"7", "007", "8"} {
+			if err := txn.ModelSet(&Receipt{Number: id}, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.ModelMigrateSortableID(&Receipt{}, 1); !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("expected ErrInvalidID but got %v", err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		// nothing is moved
+		for _, id := range []string{"7", "007", "8"} {
+			if !txn.Has("receipt:" + id) {
+				t.Errorf("expected receipt:%s to be kept", id)
+			}
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIDGenerators(t *testing.T) {
+	for _, name := range []string{"ulid", "uuidv7", "snowflake"} {
+		gen := namedGenerators[name]
+		var ids []string
+		for i := 0; i < 1000; i++ {
+			id, err := gen.NextID(nil, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		if !sort.StringsAreSorted(ids) {
+			t.Errorf("%s ids are not sorted", name)
+		}
+		if ids[0] == ids[1] {
+			t.Errorf("%s ids are not unique", name)
+		}
+		log.Printf("%s: %s", name, ids[0])
+	}
+
+	if _, err := NewTemplateID("INV-{yyyy}"); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := NewSnowflake(1024); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestModelNewID(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type Session struct {
+		ID string `db:"id=ulid"`
+	}
+	type Order struct{}
+	type Invoice struct{}
+
+	now := time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)
+	gen, err := NewTemplateID("INV-{yyyy}-{seq:5}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.(*TemplateID).Now = func() time.Time { return now }
+	SetIDGenerator(&Invoice{}, gen)
+	defer SetIDGenerator(&Invoice{}, nil)
+
+	id, err := db.ModelNewID(&Session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != 26 {
+		t.Errorf("unexpected ulid: %s", id)
+	}
+
+	var ids []string
+	err = db.Txn(func(txn *Txn) error {
+		ids = nil
+		for i := 0; i < 2; i++ {
+			id, err := txn.ModelNewID(&Invoice{})
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		now = now.AddDate(0, 0, 1)
+		id, err := txn.ModelNewID(&Invoice{})
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+
+		id, err = txn.ModelNewID(&Order{})
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"INV-2023-00001", "INV-2023-00002", "INV-2024-00001", "a1"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected '%v' but got '%v'", expected, ids)
+	}
+}
+
+func TestIndexMixedCaseID(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type Badge struct {
+		Color string `db:"index"`
+	}
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.ModelSet(&Badge{Color: "red"}, "01HXyZ"); err != nil {
+			return err
+		}
+		// an entry written before the ids were stored
+		if err := txn.Set("badge:01HAbC", `{"Color":"red"}`); err != nil {
+			return err
+		}
+		if err := txn.Set("_i:badge:color:red:01habc", ""); err != nil {
+			return err
+		}
+		_, err := txn.CounterAdd("_ic:badge:color:red", 1)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		ids, err := txn.IndexList(&Badge{}, "color", "red")
+		if err != nil {
+			return err
+		}
+		if len(ids) != 2 || ids[0] != "01habc" || ids[1] != "01HXyZ" {
+			t.Errorf("unexpected ids: %v", ids)
+		}
+		// the old entry is found by the model id
+		if err := txn.ModelSet(&Badge{Color: "blue"}, "01HAbC"); err != nil {
+			return err
+		}
+		return txn.ModelSet(&Badge{Color: "red"}, "01HXyZ")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if n := txn.IndexCount(&Badge{}, "color", "red"); n != 1 {
+			t.Errorf("unexpected count: %d", n)
+		}
+		if ids, _ := txn.IndexList(&Badge{}, "color", "blue"); len(ids) != 1 || ids[0] != "01HAbC" {
+			t.Errorf("unexpected ids: %v", ids)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
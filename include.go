@@ -0,0 +1,112 @@
+package db
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Include returns the option filling the fields of the listed models with their related models.
+// A field is a pointer or a slice of pointers to the related model, tagged with the reference field
+// like `json:"-" db:"load=UserID"`, so it is not stored.
+//
+//	type Order struct {
+//		UserID string `db:"ref=User"`
+//		User   *User  `json:"-" db:"load=UserID"`
+//	}
+//
+//	list, err := txn.ModelList(&Order{}, 20, "", false, db.Include("User"))
+func Include(fields ...string) *ListOption {
+	return &ListOption{Include: fields}
+}
+
+// checkLoadFields returns an error when a field tagged `db:"load=Field"` is stored,
+// the related models are not part of the document
+func checkLoadFields(t reflect.Type) error {
+	if t == nil {
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(tagValues(field.Tag.Get(tagName), "load")) > 0 && field.Tag.Get("json") != "-" {
+			return errors.Wrapf(ErrInvalidModel, "type: %s, field: %s, the field with a load tag needs the tag `json:\"-\"`", t, field.Name)
+		}
+	}
+	return nil
+}
+
+// include fills the fields of the models, every related model is read once in the transaction
+func (txn *Txn) include(list []any, fields []string, includeDeleted bool) error {
+	if len(list) == 0 || len(fields) == 0 {
+		return nil
+	}
+	t := modelType(list[0])
+	if t == nil {
+		return nil
+	}
+	if err := checkLoadFields(t); err != nil {
+		return err
+	}
+	refs := modelRefs(t)
+
+	for _, name := range fields {
+		field, ok := t.FieldByName(name)
+		if !ok {
+			return errors.Errorf("include %s: no such field of %s", name, t)
+		}
+		sources := tagValues(field.Tag.Get(tagName), "load")
+		if len(sources) == 0 {
+			return errors.Errorf("include %s: the field of %s has no load tag", name, t)
+		}
+		var ref *refField
+		for i := range refs {
+			if refs[i].name == sources[0] {
+				ref = &refs[i]
+			}
+		}
+		if ref == nil {
+			return errors.Errorf("include %s: the field %s of %s has no ref tag", name, sources[0], t)
+		}
+
+		// the type of the related model
+		elem := field.Type
+		if elem.Kind() == reflect.Slice {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Pointer || elem.Elem().Kind() != reflect.Struct {
+			return errors.Errorf("include %s: unsupported field type %s", name, field.Type)
+		}
+
+		loaded := map[string]reflect.Value{}
+		for _, m := range list {
+			v := reflect.ValueOf(m).Elem()
+			var related []reflect.Value
+			for _, id := range refIDs(v.Field(ref.index)) {
+				r, ok := loaded[id]
+				if !ok {
+					r = reflect.New(elem.Elem())
+					if err := txn.loadModel(ref.target, id, r.Interface(), includeDeleted); err != nil {
+						if !errors.Is(err, ErrKeyNotFound) {
+							return err
+						}
+						r = reflect.Value{}
+					}
+					loaded[id] = r
+				}
+				if r.IsValid() {
+					related = append(related, r)
+				}
+			}
+
+			dst := v.FieldByIndex(field.Index)
+			if dst.Kind() == reflect.Slice {
+				dst.Set(reflect.Append(reflect.MakeSlice(dst.Type(), 0, len(related)), related...))
+			} else if len(related) > 0 {
+				dst.Set(related[0])
+			} else {
+				dst.Set(reflect.Zero(dst.Type()))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+type incUser struct {
+	Name string
+}
+
+type incOrder struct {
+	Status   string     `db:"index"`
+	UserID   string     `db:"ref=IncUser"`
+	User     *incUser   `json:"-" db:"load=UserID"`
+	Watchers []string   `db:"ref=IncUser,on_delete=set_null"`
+	Followed []*incUser `json:"-" db:"load=Watchers"`
+}
+
+// the loaded user would be stored without `json:"-"`
+type incStoredOrder struct {
+	UserID string   `db:"ref=IncUser"`
+	User   *incUser `db:"load=UserID"`
+}
+
+func TestInclude(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		for _, id := range []string{"1", "2"} {
+			if err := txn.ModelSet(&incUser{Name: "user" + id}, id); err != nil {
+				return err
+			}
+		}
+		orders := []*incOrder{
+			{Status: "open", UserID: "1", Watchers: []string{"1", "2"}},
+			{Status: "open", UserID: "2"},
+			{Status: "closed", UserID: "1", User: &incUser{Name: "not stored"}},
+		}
+		for i, o := range orders {
+			if err := txn.ModelSet(o, i+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		list, err := txn.ModelList(&incOrder{}, 0, "", false)
+		if err != nil {
+			return err
+		}
+		if len(list) != 3 || list[2].(*incOrder).User != nil {
+			t.Errorf("expected the related models not to be loaded: %+v", list)
+		}
+
+		list, err = txn.ModelList(&incOrder{}, 0, "", false, Include("User", "Followed"))
+		if err != nil {
+			return err
+		}
+		orders := ToEntities[*incOrder](list)
+		if len(orders) != 3 {
+			t.Fatalf("unexpected list: %+v", orders)
+		}
+		for _, o := range orders {
+			if o.User == nil || o.User.Name != "user"+o.UserID {
+				t.Errorf("unexpected user: %+v", o.User)
+			}
+		}
+		if orders[0].User != orders[2].User {
+			t.Error("expected the user to be read once")
+		}
+		if f := orders[0].Followed; len(f) != 2 || f[1].Name != "user2" {
+			t.Errorf("unexpected followers: %+v", f)
+		}
+
+		list, err = txn.ModelIndexList(&incOrder{}, "Status", "open", Include("User"))
+		if err != nil {
+			return err
+		}
+		if len(list) != 2 || list[1].(*incOrder).User.Name != "user2" {
+			t.Errorf("unexpected list: %+v", list)
+		}
+
+		if _, err := txn.ModelList(&incOrder{}, 0, "", false, Include("Status")); err == nil {
+			t.Error("expected an error for a field without the load tag")
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIncludeStoredField(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := Register[incStoredOrder]("inc_stored_order", nil); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("expected ErrInvalidModel but got %v", err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.ModelSet(&incUser{Name: "user"}, 1); err != nil {
+			return err
+		}
+		return txn.ModelSet(&incStoredOrder{UserID: "1", User: &incUser{Name: "user"}}, 1)
+	})
+	if !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("expected ErrInvalidModel but got %v", err)
+	}
+}
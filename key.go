@@ -0,0 +1,260 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// type tags of the encoded key components, the order of the tags is the order of the types
+const (
+	keyNil    = 0x00
+	keyBytes  = 0x01
+	keyString = 0x02
+	keyInt    = 0x15
+	keyUint   = 0x16
+	keyFloat  = 0x21
+	keyFalse  = 0x26
+	keyTrue   = 0x27
+	keyTime   = 0x30
+	keyEnd    = 0xff
+)
+
+var ErrInvalidKey = errors.New("invalid key")
+
+// Key is a tuple of typed components, the first component is the bucket.
+// The encoded key preserves the order of the components, so integers sort numerically.
+//
+//	db.K("user", 42, "sessions")
+type Key []any
+
+func K(parts ...any) Key {
+	return Key(parts)
+}
+
+// Append returns a new key with the parts added to the end
+func (k Key) Append(parts ...any) Key {
+	n := make(Key, 0, len(k)+len(parts))
+	n = append(n, k...)
+	return append(n, parts...)
+}
+
+// Validate returns ErrInvalidKey when the bucket has a colon, the bucket is the part of a key before its first colon,
+// so such keys would not be unique. The key functions of Txn validate the keys.
+func (k Key) Validate() error {
+	if len(k) > 0 && strings.Contains(fmt.Sprintf("%v", k[0]), ":") {
+		return errors.Wrapf(ErrInvalidKey, "the bucket %q has a colon", fmt.Sprintf("%v", k[0]))
+	}
+	return nil
+}
+
+func (k Key) Bucket() string {
+	if len(k) == 0 {
+		return GetBucket("")
+	}
+	return GetBucket(fmt.Sprintf("%v", k[0]))
+}
+
+// String returns the encoded key, which can be used anywhere a key string is accepted
+func (k Key) String() string {
+	var b bytes.Buffer
+	b.WriteString(k.Bucket())
+	b.WriteByte(':')
+	if len(k) > 1 {
+		for _, v := range k[1:] {
+			encodeKeyPart(&b, v)
+		}
+	}
+	return b.String()
+}
+
+// Prefix returns the prefix shared by the key and all keys extending it
+func (k Key) Prefix() string {
+	return k.String()
+}
+
+// Range returns the first and the last(not included) key extending the key,
+// they can be used as ListOption.Begin and ListOption.End
+func (k Key) Range() (begin, end string) {
+	begin = k.Prefix()
+	end = begin + string([]byte{keyEnd})
+	return
+}
+
+func encodeKeyPart(b *bytes.Buffer, val any) {
+	var buf [8]byte
+	switch v := val.(type) {
+	case nil:
+		b.WriteByte(keyNil)
+	case []byte:
+		b.WriteByte(keyBytes)
+		writeEscaped(b, v)
+	case string:
+		b.WriteByte(keyString)
+		writeEscaped(b, []byte(v))
+	case int:
+		writeInt(b, int64(v))
+	case int8:
+		writeInt(b, int64(v))
+	case int16:
+		writeInt(b, int64(v))
+	case int32:
+		writeInt(b, int64(v))
+	case int64:
+		writeInt(b, v)
+	case uint:
+		writeUint(b, uint64(v))
+	case uint8:
+		writeUint(b, uint64(v))
+	case uint16:
+		writeUint(b, uint64(v))
+	case uint32:
+		writeUint(b, uint64(v))
+	case uint64:
+		writeUint(b, v)
+	case float32:
+		writeFloat(b, float64(v))
+	case float64:
+		writeFloat(b, v)
+	case bool:
+		if v {
+			b.WriteByte(keyTrue)
+		} else {
+			b.WriteByte(keyFalse)
+		}
+	case time.Time:
+		b.WriteByte(keyTime)
+		binary.BigEndian.PutUint64(buf[:], uint64(v.UnixNano())^(1<<63))
+		b.Write(buf[:])
+	case *time.Time:
+		if v == nil {
+			b.WriteByte(keyNil)
+			return
+		}
+		encodeKeyPart(b, *v)
+	case fmt.Stringer:
+		encodeKeyPart(b, v.String())
+	default:
+		encodeKeyPart(b, fmt.Sprintf("%v", v))
+	}
+}
+
+// 0x00 is escaped as 0x00 0xff, the part ends with a single 0x00
+func writeEscaped(b *bytes.Buffer, v []byte) {
+	for _, c := range v {
+		b.WriteByte(c)
+		if c == 0x00 {
+			b.WriteByte(0xff)
+		}
+	}
+	b.WriteByte(0x00)
+}
+
+func writeInt(b *bytes.Buffer, v int64) {
+	var buf [8]byte
+	b.WriteByte(keyInt)
+	binary.BigEndian.PutUint64(buf[:], uint64(v)^(1<<63))
+	b.Write(buf[:])
+}
+
+// values that fit into int64 share the encoding of the signed integers
+func writeUint(b *bytes.Buffer, v uint64) {
+	if v <= math.MaxInt64 {
+		writeInt(b, int64(v))
+		return
+	}
+	var buf [8]byte
+	b.WriteByte(keyUint)
+	binary.BigEndian.PutUint64(buf[:], v)
+	b.Write(buf[:])
+}
+
+func writeFloat(b *bytes.Buffer, v float64) {
+	var buf [8]byte
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits ^= 1 << 63
+	}
+	b.WriteByte(keyFloat)
+	binary.BigEndian.PutUint64(buf[:], bits)
+	b.Write(buf[:])
+}
+
+// ParseKey decodes a key created by Key.String.
+// Integers are returned as int64 (or uint64 when they overflow int64), floats as float64.
+func ParseKey(key string) (Key, error) {
+	bucket, rest, ok := strings.Cut(key, ":")
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidKey, "key: %q", key)
+	}
+
+	k := Key{bucket}
+	raw := []byte(rest)
+	for len(raw) > 0 {
+		tag := raw[0]
+		raw = raw[1:]
+		switch tag {
+		case keyNil:
+			k = append(k, nil)
+		case keyBytes, keyString:
+			var v []byte
+			i := 0
+			for ; i < len(raw); i++ {
+				if raw[i] != 0x00 {
+					v = append(v, raw[i])
+					continue
+				}
+				if i+1 < len(raw) && raw[i+1] == 0xff {
+					v = append(v, 0x00)
+					i++
+					continue
+				}
+				break
+			}
+			if i >= len(raw) {
+				return nil, errors.Wrapf(ErrInvalidKey, "key: %q", key)
+			}
+			raw = raw[i+1:]
+			if tag == keyBytes {
+				k = append(k, v)
+			} else {
+				k = append(k, string(v))
+			}
+		case keyInt, keyUint, keyFloat, keyTime:
+			if len(raw) < 8 {
+				return nil, errors.Wrapf(ErrInvalidKey, "key: %q", key)
+			}
+			u := binary.BigEndian.Uint64(raw[:8])
+			raw = raw[8:]
+			switch tag {
+			case keyInt:
+				k = append(k, int64(u^(1<<63)))
+			case keyUint:
+				k = append(k, u)
+			case keyFloat:
+				if u&(1<<63) != 0 {
+					u ^= 1 << 63
+				} else {
+					u = ^u
+				}
+				k = append(k, math.Float64frombits(u))
+			case keyTime:
+				k = append(k, time.Unix(0, int64(u^(1<<63))))
+			}
+		case keyFalse:
+			k = append(k, false)
+		case keyTrue:
+			k = append(k, true)
+		default:
+			return nil, errors.Wrapf(ErrInvalidKey, "key: %q", key)
+		}
+	}
+	return k, nil
+}
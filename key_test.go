@@ -0,0 +1,137 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestKeyOrder(t *testing.T) {
+	keys := []Key{
+		K("user", -1000),
+		K("user", -1),
+		K("user", 0),
+		K("user", 2),
+		K("user", 10),
+		K("user", 42, "a"),
+		K("user", 42, "sessions"),
+		K("user", 42, "sessions", 1),
+		K("user", 100),
+		K("user", uint64(1<<63)),
+		K("user", -1.5),
+		K("user", 0.5),
+		K("user", false),
+		K("user", true),
+	}
+
+	var encoded []string
+	for _, k := range keys {
+		encoded = append(encoded, k.String())
+	}
+	if !sort.StringsAreSorted(encoded) {
+		t.Fatal("encoded keys are not sorted")
+	}
+
+	for _, k := range keys {
+		parsed, err := ParseKey(k.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.String() != k.String() {
+			t.Errorf("expected '%v' but got '%v'", k, parsed)
+		}
+	}
+}
+
+func TestParseKeyValues(t *testing.T) {
+	k, err := ParseKey(K("user", 42, "a\x00b", []byte{0, 0xff}, 1.25, true, nil).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Key{"user", int64(42), "a\x00b", []byte{0, 0xff}, 1.25, true, nil}
+	if !reflect.DeepEqual(k, expected) {
+		t.Errorf("expected '%v' but got '%v'", expected, k)
+	}
+
+	if _, err := ParseKey("no-colon"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestKeyTxn(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		for i := 0; i < 20; i++ {
+			if err := txn.SetKey(K("user", 42, "sessions", i), fmt.Sprintf("s%d", i)); err != nil {
+				return err
+			}
+		}
+		return txn.SetKey(K("user", 43), "other")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	err = db.ListKey(K("user", 42, "sessions"), func(key string, value []byte) (bool, error) {
+		k, err := ParseKey(key)
+		if err != nil {
+			return true, err
+		}
+		ids = append(ids, k[3].(int64))
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 20 || ids[0] != 0 || ids[19] != 19 {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+
+	begin, _ := K("user", 42, "sessions", 5).Range()
+	_, end := K("user", 42, "sessions", 9).Range()
+	ids = nil
+	err = db.ListKey(K("user", 42), func(key string, value []byte) (bool, error) {
+		k, _ := ParseKey(key)
+		ids = append(ids, k[3].(int64))
+		return false, nil
+	}, &ListOption{Begin: begin, ContainBegin: true, End: end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []int64{5, 6, 7, 8, 9}) {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.DelKey(K("user", 43)); err != nil {
+			return err
+		}
+		if txn.HasKey(K("user", 43)) {
+			return fmt.Errorf("key was not deleted")
+		}
+		raw, err := txn.GetKey(K("user", 42, "sessions", 3))
+		if err != nil {
+			return err
+		}
+		if string(raw) != "s3" {
+			return fmt.Errorf("unexpected value: %s", raw)
+		}
+		// "user:a" and "user:b" would share the bucket "user"
+		if err := txn.SetKey(K("user:a", 1), "a"); !errors.Is(err, ErrInvalidKey) {
+			return fmt.Errorf("expected ErrInvalidKey but got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
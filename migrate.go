@@ -0,0 +1,304 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+
+	// returned by a transaction of a dry run, so it is rolled back
+	errDryRun = errors.New("dry run")
+)
+
+// Migration changes the stored data from one schema to the next, it is applied once in the order of the ids
+type Migration struct {
+	ID   int
+	Name string
+	// Up runs in one write transaction with the record of the migration
+	Up func(txn *Txn) error
+	// Chunked runs in many write transactions for large data sets, it is recorded after it returns,
+	// so it must be able to run again when it is interrupted
+	Chunked func(m *Migrator) error
+}
+
+type Migrations []Migration
+
+type MigrateOptions struct {
+	DryRun    bool // Run the migrations and roll back all their transactions
+	BatchSize int  // The number of keys in one transaction of a chunked migration, 1000 by default
+	To        int  // Stop after the migration with the id, 0 applies all
+}
+
+type MigrationResult struct {
+	ID     int
+	Name   string
+	Keys   int // the number of written and deleted keys
+	DryRun bool
+}
+
+// AppliedMigration is the record of a migration in the bucket "_migrations"
+type AppliedMigration struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func migrationKey(id int) string {
+	return fmt.Sprintf("_migrations:%010d", id)
+}
+
+// AppliedMigrations returns the applied migrations in the order of the ids
+func (t *DB) AppliedMigrations() (list []AppliedMigration, err error) {
+	err = t.Txn(func(txn *Txn) error {
+		return txn.List("_migrations:", func(key string, value []byte) (bool, error) {
+			var m AppliedMigration
+			if err := json.Unmarshal(value, &m); err != nil {
+				return true, errors.Wrapf(err, "key: %s", key)
+			}
+			list = append(list, m)
+			return false, nil
+		})
+	}, true)
+	return
+}
+
+// Migrate applies the migrations that are not applied yet, and returns the results of the applied ones
+func (t *DB) Migrate(migrations Migrations, opts *MigrateOptions) (results []MigrationResult, err error) {
+	if opts == nil {
+		opts = &MigrateOptions{}
+	}
+
+	list := append(Migrations{}, migrations...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	for i, m := range list {
+		if m.ID <= 0 || (m.Up == nil) == (m.Chunked == nil) {
+			return nil, errors.Wrapf(ErrInvalidMigration, "id: %d, name: %s, it needs a positive id and either Up or Chunked", m.ID, m.Name)
+		}
+		if i > 0 && list[i-1].ID == m.ID {
+			return nil, errors.Wrapf(ErrInvalidMigration, "duplicate id: %d", m.ID)
+		}
+	}
+
+	applied := map[int]bool{}
+	records, err := t.AppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		applied[r.ID] = true
+	}
+
+	for _, m := range list {
+		if opts.To > 0 && m.ID > opts.To {
+			break
+		}
+		if applied[m.ID] {
+			continue
+		}
+
+		result, err := t.migrate(m, opts)
+		if err != nil {
+			return results, errors.Wrapf(err, "migration: %d %s", m.ID, m.Name)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (t *DB) migrate(m Migration, opts *MigrateOptions) (MigrationResult, error) {
+	result := MigrationResult{ID: m.ID, Name: m.Name, DryRun: opts.DryRun}
+	migrator := &Migrator{db: t, dryRun: opts.DryRun, size: opts.BatchSize}
+	if migrator.size <= 0 {
+		migrator.size = defaultChunkSize
+	}
+
+	record := func(txn *Txn) error {
+		return txn.Set(migrationKey(m.ID), AppliedMigration{ID: m.ID, Name: m.Name, AppliedAt: txn.now()})
+	}
+	if m.Up != nil {
+		err := migrator.Txn(func(txn *Txn) error {
+			if err := m.Up(txn); err != nil {
+				return err
+			}
+			result.Keys = txn.writes
+			return record(txn)
+		})
+		return result, err
+	}
+
+	if err := m.Chunked(migrator); err != nil {
+		return result, err
+	}
+	result.Keys = migrator.keys
+	return result, migrator.Txn(record)
+}
+
+// Migrator runs the transactions of a migration, they are rolled back in a dry run
+type Migrator struct {
+	db     *DB
+	dryRun bool
+	size   int
+	keys   int
+}
+
+func (m *Migrator) DryRun() bool {
+	return m.dryRun
+}
+
+// Txn runs fn in one write transaction
+func (m *Migrator) Txn(fn func(txn *Txn) error) error {
+	var txn *Txn
+	var err error
+	if m.dryRun {
+		err = m.db.update(func(tx *bolt.Tx) error {
+			txn = &Txn{t: tx, db: m.db}
+			if err := fn(txn); err != nil {
+				return err
+			}
+			return errDryRun
+		})
+		if errors.Is(err, errDryRun) {
+			err = nil
+		}
+	} else {
+		err = m.db.Txn(func(t *Txn) error {
+			txn = t
+			return fn(t)
+		})
+	}
+	if err == nil {
+		m.keys += txn.writes
+	}
+	return err
+}
+
+// Each calls fn with the keys with the prefix in chunked transactions, fn may update or delete the key
+func (m *Migrator) Each(prefix string, fn func(txn *Txn, key string, value []byte) error) error {
+	last := ""
+	for {
+		var keys []string
+		err := m.Txn(func(txn *Txn) error {
+			keys = nil
+			var values [][]byte
+			err := txn.List(prefix, func(key string, value []byte) (bool, error) {
+				keys = append(keys, key)
+				values = append(values, value)
+				return false, nil
+			}, &ListOption{Begin: last, Limit: m.size})
+			if err != nil {
+				return err
+			}
+			for i, key := range keys {
+				if err := fn(txn, key, values[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(keys) < m.size {
+			return nil
+		}
+		last = keys[len(keys)-1]
+	}
+}
+
+// moveKey moves the stored value to another key, the expiry of the key is dropped
+func moveKey(txn *Txn, from, to string) error {
+	raw := txn.get(from)
+	if raw == nil {
+		return nil
+	}
+	if err := txn.put(to, append([]byte{}, raw...)); err != nil {
+		return err
+	}
+	if err := txn.bumpVersion(to, 0); err != nil {
+		return err
+	}
+	return txn.Del(from)
+}
+
+// RenameModel moves the models, the index data, the references and the counters of the model oldName to newName,
+// the names are the ones returned by ToModelName
+func (m *Migrator) RenameModel(oldName, newName string) error {
+	if oldName == "" || newName == "" || oldName == newName {
+		return errors.Wrapf(ErrInvalidMigration, "rename model from '%s' to '%s'", oldName, newName)
+	}
+
+	move := func(oldPrefix, newPrefix string) error {
+		return m.Each(oldPrefix, func(txn *Txn, key string, value []byte) error {
+			return moveKey(txn, key, newPrefix+strings.TrimPrefix(key, oldPrefix))
+		})
+	}
+
+	// the base keys of the indexes are lower case
+	prefixes := [][2]string{
+		{oldName + ":", newName + ":"},
+		{"_i:" + strings.ToLower(oldName) + ":", "_i:" + strings.ToLower(newName) + ":"},
+		{"_ic:" + strings.ToLower(oldName) + ":", "_ic:" + strings.ToLower(newName) + ":"},
+		{"_seq:" + oldName + ":", "_seq:" + newName + ":"},
+		{"_deleted:" + oldName + ":", "_deleted:" + newName + ":"},
+		{"_history:" + oldName + ":", "_history:" + newName + ":"},
+	}
+	for _, p := range prefixes {
+		if err := move(p[0], p[1]); err != nil {
+			return err
+		}
+	}
+
+	// the keys of the reverse index are "_ref:target:targetID:model:field:id", the model is on both sides
+	err := m.Each("_ref:", func(txn *Txn, key string, value []byte) error {
+		parts := strings.SplitN(key, ":", 6)
+		if len(parts) != 6 || (parts[1] != oldName && parts[3] != oldName) {
+			return nil
+		}
+		if parts[1] == oldName {
+			parts[1] = newName
+		}
+		if parts[3] == oldName {
+			parts[3] = newName
+		}
+		return moveKey(txn, key, strings.Join(parts, ":"))
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.Txn(func(txn *Txn) error {
+		for _, bucket := range []string{"_total", "_counter", "_id_len", "_id_fmt"} {
+			if err := moveKey(txn, bucket+":"+oldName, bucket+":"+newName); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RewriteDocuments decodes the models of modelName as maps, and stores the ones for which fn returns true.
+// The indexes are not updated, rebuild them when an indexed field is changed.
+func (m *Migrator) RewriteDocuments(modelName string, fn func(doc map[string]any) (changed bool, err error)) error {
+	return m.Each(modelName+":", func(txn *Txn, key string, value []byte) error {
+		doc := map[string]any{}
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return errors.Wrapf(err, "key: %s", key)
+		}
+		changed, err := fn(doc)
+		if err != nil || !changed {
+			return err
+		}
+		return txn.Set(key, doc)
+	})
+}
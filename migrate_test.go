@@ -0,0 +1,110 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type legacyUser struct {
+		FullName string `db:"index=name"`
+	}
+	err = db.Txn(func(txn *Txn) error {
+		for _, name := range []string{"alice", "bob", "carol"} {
+			if err := txn.ModelSet(&legacyUser{FullName: name}, txn.ModelNextID(&legacyUser{}, 3)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations := Migrations{
+		{ID: 2, Name: "rename full name", Chunked: func(m *Migrator) error {
+			return m.RewriteDocuments("member", func(doc map[string]any) (bool, error) {
+				doc["Name"] = doc["FullName"]
+				delete(doc, "FullName")
+				return true, nil
+			})
+		}},
+		{ID: 1, Name: "rename legacy user", Chunked: func(m *Migrator) error {
+			return m.RenameModel("legacy_user", "member")
+		}},
+		{ID: 3, Name: "settings", Up: func(txn *Txn) error {
+			return txn.Set("settings:theme", "dark")
+		}},
+	}
+
+	// a dry run reports the changes and keeps the data
+	results, err := db.Migrate(migrations, &MigrateOptions{DryRun: true, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].ID != 1 || results[0].Keys == 0 || !results[0].DryRun {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if applied, _ := db.AppliedMigrations(); len(applied) != 0 {
+		t.Fatalf("unexpected applied migrations: %+v", applied)
+	}
+	db.Close()
+
+	// the migrations are applied on open
+	db, err = Open(path, &Options{Migrations: migrations[:2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type member struct {
+		Name string `db:"index=name"`
+	}
+	err = db.Txn(func(txn *Txn) error {
+		if txn.Has("legacy_user:001") {
+			t.Error("expected the old key to be moved")
+		}
+		m, err := txn.ModelGet(&member{}, "002")
+		if err != nil {
+			return err
+		}
+		if name := m.(*member).Name; name != "bob" {
+			t.Errorf("expected bob but got %s", name)
+		}
+		if ids, _ := txn.IndexList(&member{}, "name", "carol"); len(ids) != 1 || ids[0] != "003" {
+			t.Errorf("unexpected index: %v", ids)
+		}
+		if total, counter := txn.ModelTotal(&member{}), txn.ModelCounter(&member{}); total != 3 || counter != 3 {
+			t.Errorf("unexpected total %d and counter %d", total, counter)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = db.Migrate(migrations, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != 3 || results[0].Keys == 0 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	applied, err := db.AppliedMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 || applied[2].Name != "settings" || applied[2].AppliedAt.IsZero() {
+		t.Errorf("unexpected applied migrations: %+v", applied)
+	}
+
+	if _, err := db.Migrate(Migrations{{ID: 4}}, nil); err == nil {
+		t.Error("expected an error for a migration without Up")
+	}
+}
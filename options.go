@@ -1,9 +1,33 @@
 package db
 
+import "time"
+
+type Options struct {
+	ReadOnly      bool             // Open the database in read-only mode
+	Clock         func() time.Time // The clock of the expiry of keys and the model timestamps, time.Now by default
+	SweepInterval time.Duration    // The interval of purging expired keys, 0 disables the sweeper
+	SweepBatch    int              // The maximum number of expired keys purged in one write
+	ChangeLog     bool             // Record every committed change in the log bucket "_log"
+	LogRetention  time.Duration    // The sweeper truncates the log entries older than it, 0 keeps them
+	LogMaxEntries int              // The sweeper truncates the oldest log entries beyond it, 0 keeps them
+	Migrations    Migrations       // The migrations applied by Open
+	WatchQueue    int              // The maximum number of events queued for a watcher, the later ones are dropped
+}
+
+var DefaultOptions = Options{
+	SweepInterval: time.Minute,
+	SweepBatch:    1000,
+	WatchQueue:    10000,
+}
+
 type ListOption struct {
 	Begin        string // The starting key, not included by default
 	ContainBegin bool   // The result contains the key of begin
+	End          string // The key to stop at, not included
 	Reverse      bool   // Iterate from back to front
 	Limit        int    // The maximum number of iterations
 	KeyOnly      bool   // Only iterate over keys
+
+	IncludeDeleted bool     // IndexList and ModelIndexList also return the soft deleted models
+	Include        []string // The fields of the listed models filled with the related models, see Include
 }
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var ErrIndexNotFound = errors.New("index not found")
+
+type RebuildOptions struct {
+	BatchSize int                     // The number of models indexed in one transaction, 1000 by default
+	Progress  func(p RebuildProgress) // Called after each committed chunk
+}
+
+type RebuildProgress struct {
+	Model   string
+	Indexes []string // the rebuilt indexes
+	Done    int      // the number of models indexed by this run
+	Total   int64    // the total of the model
+	Key     string   // the last indexed key, an interrupted rebuild resumes after it
+}
+
+// normalizeIndexName returns the index name as it is in the base keys
+func normalizeIndexName(name string) string {
+	return strings.ToLower(ToSnake(name))
+}
+
+// indexNames returns the names of the indexes declared by the tags of the model
+func indexNames(model any) []string {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := modelFieldIndex(t, i)
+		if !ok {
+			continue
+		}
+		name = normalizeIndexName(name)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fieldIndexNameOf returns the normalized index name of the indexed field, field is the Go name or the index name
+func fieldIndexNameOf(model any, field string) (string, bool) {
+	t := modelType(model)
+	if t == nil {
+		return "", false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Name != field {
+			continue
+		}
+		if name, ok := modelFieldIndex(t, i); ok {
+			return normalizeIndexName(name), true
+		}
+	}
+	field = normalizeIndexName(field)
+	for _, name := range indexNames(model) {
+		if name == field {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// RebuildIndex drops the entries of the index and indexes all stored models again in chunks, field is the Go name or the index name.
+// An interrupted rebuild resumes from its last chunk, the stale index of a field without the tag is only dropped.
+// It returns ErrIndexNotFound when the index is neither declared nor stored.
+func (t *DB) RebuildIndex(model any, field string, opts *RebuildOptions) error {
+	if name, ok := fieldIndexNameOf(model, field); ok {
+		return t.rebuildIndexes(model, []string{name}, name, opts)
+	}
+
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return err
+	}
+	name := normalizeIndexName(field)
+	stored := false
+	err = t.Txn(func(txn *Txn) error {
+		for _, prefix := range []string{"_i:", "_ic:"} {
+			prefix += fmt.Sprintf("%s:%s:", strings.ToLower(modelName), name)
+			err := txn.List(prefix, func(key string, value []byte) (bool, error) {
+				stored = true
+				return true, nil
+			}, &ListOption{KeyOnly: true, Limit: 1})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, true)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return errors.Wrapf(ErrIndexNotFound, "model: %s, index: %s", modelName, field)
+	}
+	return t.dropIndexes(model, func(n string) bool { return n == name }, opts)
+}
+
+// RebuildAllIndexes drops the indexes that are no longer declared by the tags, and rebuilds the others
+func (t *DB) RebuildAllIndexes(model any, opts *RebuildOptions) error {
+	names := indexNames(model)
+	declared := map[string]bool{}
+	for _, name := range names {
+		declared[name] = true
+	}
+	if err := t.dropIndexes(model, func(name string) bool { return !declared[name] }, opts); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return t.rebuildIndexes(model, names, "*", opts)
+}
+
+// dropIndexes deletes the index entries and counts of the indexes matched by drop
+func (t *DB) dropIndexes(model any, drop func(name string) bool, opts *RebuildOptions) error {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return err
+	}
+	if opts == nil {
+		opts = &RebuildOptions{}
+	}
+
+	// the keys are "_i:model:index:value:id" and "_ic:model:index:value" in lower case
+	for _, prefix := range []string{"_i:", "_ic:"} {
+		prefix += strings.ToLower(modelName) + ":"
+		err := t.chunks(prefix, "", opts.BatchSize, func(txn *Txn, keys []string) error {
+			for _, key := range keys {
+				name, _, _ := strings.Cut(strings.TrimPrefix(key, prefix), ":")
+				if !drop(name) {
+					continue
+				}
+				if err := txn.Del(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *DB) rebuildIndexes(model any, names []string, task string, opts *RebuildOptions) error {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" || NewModel(model) == nil {
+		return err
+	}
+	if opts == nil {
+		opts = &RebuildOptions{}
+	}
+
+	// the last indexed key is stored, so the rebuild resumes after it
+	state := fmt.Sprintf("_rebuild:%s:%s", modelName, task)
+	progress := RebuildProgress{Model: modelName, Indexes: names}
+	resume := false
+	err = t.Txn(func(txn *Txn) error {
+		if raw, err := txn.Get(state); err == nil {
+			progress.Key, resume = string(raw), true
+		}
+		progress.Total = txn.modelTotal(modelName)
+		return nil
+	}, true)
+	if err != nil {
+		return err
+	}
+
+	rebuilt := map[string]bool{}
+	for _, name := range names {
+		rebuilt[name] = true
+	}
+	if !resume {
+		if err := t.dropIndexes(model, func(name string) bool { return rebuilt[name] }, opts); err != nil {
+			return err
+		}
+		if err := t.Txn(func(txn *Txn) error { return txn.Set(state, "") }); err != nil {
+			return err
+		}
+	}
+
+	prefix := modelName + ":"
+	err = t.chunks(prefix, progress.Key, opts.BatchSize, func(txn *Txn, keys []string) error {
+		for _, key := range keys {
+			// the models that can not be decoded are reported by Verify
+			m := NewModel(model)
+			if err := txn.unmarshalModel(key, m); err != nil {
+				continue
+			}
+			id := strings.TrimPrefix(key, prefix)
+			err := eachIndex(m, func(modelName, indexName string, val any) error {
+				if !rebuilt[normalizeIndexName(indexName)] {
+					return nil
+				}
+				return txn.indexAdd(modelName, indexName, val, id)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return txn.Set(state, keys[len(keys)-1])
+	}, func(keys []string) {
+		progress.Done += len(keys)
+		progress.Key = keys[len(keys)-1]
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return t.Txn(func(txn *Txn) error { return txn.Del(state) })
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestRebuildIndexes(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the models are stored before the field gets the index tag
+	{
+		type rebuildUser struct {
+			Name string
+		}
+		err = db.Txn(func(txn *Txn) error {
+			for i := 1; i <= 5; i++ {
+				if err := txn.ModelSet(&rebuildUser{Name: fmt.Sprintf("user%d", i%2)}, i); err != nil {
+					return err
+				}
+			}
+			return txn.IndexAdd("rebuild_user", "old", "x", 1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type rebuildUser struct {
+		Name string `db:"index"`
+	}
+	var progress []RebuildProgress
+	opts := &RebuildOptions{BatchSize: 2, Progress: func(p RebuildProgress) {
+		progress = append(progress, p)
+	}}
+	if err := db.RebuildAllIndexes(&rebuildUser{}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 3 || progress[2].Done != 5 || progress[2].Total != 5 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+
+	check := func(user1, user0 int64) {
+		t.Helper()
+		err = db.Txn(func(txn *Txn) error {
+			if c := txn.IndexCount(&rebuildUser{}, "Name", "user1"); c != user1 {
+				t.Errorf("expected %d models of user1 but got %d", user1, c)
+			}
+			if c := txn.IndexCount(&rebuildUser{}, "Name", "user0"); c != user0 {
+				t.Errorf("expected %d models of user0 but got %d", user0, c)
+			}
+			if txn.Has("_i:rebuild_user:old:x:1") || txn.IndexCount("rebuild_user", "old", "x") != 0 {
+				t.Error("expected the stale index to be dropped")
+			}
+			return nil
+		}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(3, 2)
+
+	// an interrupted rebuild resumes after the last indexed key
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.IndexClear(&rebuildUser{}, "Name", "user1"); err != nil {
+			return err
+		}
+		if err := txn.IndexClear(&rebuildUser{}, "Name", "user0"); err != nil {
+			return err
+		}
+		return txn.Set("_rebuild:rebuild_user:name", "rebuild_user:3")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RebuildIndex(&rebuildUser{}, "Name", nil); err != nil {
+		t.Fatal(err)
+	}
+	check(1, 1)
+
+	// the next rebuild starts over
+	if err := db.RebuildIndex(&rebuildUser{}, "Name", nil); err != nil {
+		t.Fatal(err)
+	}
+	check(3, 2)
+}
+
+func TestRebuildIndexField(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type rebuildMember struct {
+		Email string
+	}
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSet(&rebuildMember{Email: "a@x"}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the field is found by its Go name, the index has another name
+	{
+		type rebuildMember struct {
+			Email string `db:"index=mail"`
+		}
+		if err := db.RebuildIndex(&rebuildMember{}, "Email", nil); err != nil {
+			t.Fatal(err)
+		}
+		err = db.Txn(func(txn *Txn) error {
+			if c := txn.IndexCount(&rebuildMember{}, "mail", "a@x"); c != 1 {
+				t.Errorf("expected 1 model but got %d", c)
+			}
+			return nil
+		}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the stale index is dropped, an unknown index is an error
+	if err := db.RebuildIndex(&rebuildMember{}, "mail", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RebuildIndex(&rebuildMember{}, "mail", nil); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("expected ErrIndexNotFound but got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"unicode/utf8"
+
+	json "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+// Record is the readable form of a key and its uncompressed value used by the exports.
+// A json value is embedded as is, other values are stored as text or base64.
+type Record struct {
+	Key         string          `json:"key"`
+	KeyEncoding string          `json:"key_encoding,omitempty"` // base64 when the key is not utf-8
+	Type        string          `json:"type,omitempty"`         // json, text or binary(base64)
+	Value       json.RawMessage `json:"value,omitempty"`
+}
+
+func newRecord(key string, value []byte) *Record {
+	r := &Record{Key: key}
+	if !utf8.ValidString(key) {
+		r.Key = base64.StdEncoding.EncodeToString([]byte(key))
+		r.KeyEncoding = "base64"
+	}
+
+	// json values are kept only if the encoder keeps them byte by byte
+	var compact bytes.Buffer
+	switch {
+	case len(value) > 0 && json.Valid(value) && json.Compact(&compact, value) == nil && bytes.Equal(compact.Bytes(), value):
+		r.Type = "json"
+		r.Value = value
+	case utf8.Valid(value):
+		r.Type = "text"
+		r.Value, _ = json.Marshal(string(value))
+	default:
+		r.Type = "binary"
+		r.Value, _ = json.Marshal(base64.StdEncoding.EncodeToString(value))
+	}
+	return r
+}
+
+// RawKey returns the original key
+func (r *Record) RawKey() (string, error) {
+	if r.KeyEncoding != "base64" {
+		return r.Key, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(r.Key)
+	return string(key), err
+}
+
+// Bytes returns the original value
+func (r *Record) Bytes() ([]byte, error) {
+	switch r.Type {
+	case "json":
+		return []byte(r.Value), nil
+	case "text", "binary":
+		var text string
+		if err := json.Unmarshal(r.Value, &text); err != nil {
+			return nil, err
+		}
+		if r.Type == "text" {
+			return []byte(text), nil
+		}
+		return base64.StdEncoding.DecodeString(text)
+	case "":
+		return nil, nil
+	}
+	return nil, errors.Errorf("unknown record type: %s", r.Type)
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidModel      = errors.New("invalid model")
+	ErrUnregisteredModel = errors.New("the model is not registered")
+	ErrAmbiguousModel    = errors.New("the model name is used by another type")
+)
+
+// ModelOptions are the settings of a registered model
+type ModelOptions struct {
+	IDGenerator IDGenerator          // The id strategy, see SetIDGenerator
+	Indexes     map[string]string    // The indexed fields and their index names, like the tag `db:"index=name"`
+	Codec       Codec                // Encodes the stored models, DefaultCodec by default
+	Hooks       map[HookEvent][]Hook // The hooks of the model, called after its methods
+	History     *HistoryPolicy       // Keeps the revisions of the models, see ModelHistory
+}
+
+type modelInfo struct {
+	name string
+	typ  reflect.Type
+	opts ModelOptions
+}
+
+var modelRegistry = struct {
+	sync.RWMutex
+	types  map[reflect.Type]*modelInfo
+	names  map[string]*modelInfo
+	strict bool
+}{types: map[reflect.Type]*modelInfo{}, names: map[string]*modelInfo{}}
+
+// Register registers the struct type T as the model name, the name is converted to snake case like ToModelName.
+// An empty name keeps the name derived from the type. The model functions use the name of the registry,
+// so the Go type can be renamed or moved without orphaning the stored models. Registering again replaces the options.
+func Register[T any](name string, opts *ModelOptions) error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return errors.Wrapf(ErrInvalidModel, "type: %s, a model is a struct", t)
+	}
+	if name == "" {
+		name = t.Name()
+	}
+	name = ToSnake(name)
+	if name == "" || strings.ContainsAny(name, ":") {
+		return errors.Wrapf(ErrInvalidModel, "type: %s, name: '%s'", t, name)
+	}
+
+	if err := checkLoadFields(t); err != nil {
+		return err
+	}
+	if err := checkDefaults(t); err != nil {
+		return err
+	}
+
+	info := &modelInfo{name: name, typ: t}
+	if opts != nil {
+		info.opts = *opts
+	}
+
+	modelRegistry.Lock()
+	if other, ok := modelRegistry.names[name]; ok && other.typ != t {
+		modelRegistry.Unlock()
+		return errors.Wrapf(ErrAmbiguousModel, "name: %s, types: %s and %s", name, other.typ, t)
+	}
+	if other, ok := modelRegistry.types[t]; ok && other.name != name {
+		modelRegistry.Unlock()
+		return errors.Wrapf(ErrAmbiguousModel, "type: %s, names: %s and %s", t, other.name, name)
+	}
+	modelRegistry.types[t] = info
+	modelRegistry.names[name] = info
+	modelRegistry.Unlock()
+
+	if info.opts.IDGenerator != nil {
+		setIDGenerator(name, info.opts.IDGenerator)
+	}
+	return nil
+}
+
+// SetStrictModels makes the model functions fail for the struct types that are not registered
+func SetStrictModels(strict bool) {
+	modelRegistry.Lock()
+	defer modelRegistry.Unlock()
+	modelRegistry.strict = strict
+}
+
+func registeredModel(t reflect.Type) *modelInfo {
+	modelRegistry.RLock()
+	defer modelRegistry.RUnlock()
+	return modelRegistry.types[t]
+}
+
+// registeredType returns the struct type registered as the name
+func registeredType(name string) (reflect.Type, bool) {
+	modelRegistry.RLock()
+	defer modelRegistry.RUnlock()
+	if info, ok := modelRegistry.names[name]; ok {
+		return info.typ, true
+	}
+	return nil, false
+}
+
+// registeredModels returns a new model of each registered type, ordered by the names
+func registeredModels() (list []any) {
+	modelRegistry.RLock()
+	names := make([]string, 0, len(modelRegistry.names))
+	for name := range modelRegistry.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list = append(list, reflect.New(modelRegistry.names[name].typ).Interface())
+	}
+	modelRegistry.RUnlock()
+	return
+}
+
+// modelNameOf returns the name of the model by the registry, or derived from the type.
+// A struct type is rejected in strict mode when it is not registered,
+// and always when its derived name is registered by another type.
+// The other kinds, such as a string of the name, are only accepted out of strict mode.
+func modelNameOf(model any) (string, error) {
+	v := reflect.ValueOf(model)
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return "", nil
+	}
+	t := modelType(model)
+
+	modelRegistry.RLock()
+	info := modelRegistry.types[t]
+	strict := modelRegistry.strict
+	modelRegistry.RUnlock()
+	if t == nil {
+		if strict {
+			return "", errors.Wrapf(ErrInvalidModel, "model: %v, the name is derived from the value, a model is a struct in strict mode", model)
+		}
+		return deriveModelName(model), nil
+	}
+	if info != nil {
+		return info.name, nil
+	}
+
+	name := deriveModelName(model)
+	if other, ok := registeredType(name); ok && other != t {
+		return "", errors.Wrapf(ErrAmbiguousModel, "name: %s, types: %s and %s", name, other, t)
+	}
+	if strict {
+		return "", errors.Wrapf(ErrUnregisteredModel, "type: %s", t)
+	}
+	return name, nil
+}
+
+// modelCodec returns the codec of the registered model
+func modelCodec(model any) Codec {
+	if t := modelType(model); t != nil {
+		if info := registeredModel(t); info != nil && info.opts.Codec != nil {
+			return info.opts.Codec
+		}
+	}
+	return DefaultCodec
+}
+
+// registeredIndex returns the index name of the field set by the registry
+func registeredIndex(t reflect.Type, field string) (string, bool) {
+	info := registeredModel(t)
+	if info == nil {
+		return "", false
+	}
+	name, ok := info.opts.Indexes[field]
+	if ok && name == "" {
+		name = field
+	}
+	return name, ok
+}
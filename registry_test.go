@@ -0,0 +1,110 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+type registryAccount struct {
+	Email string
+	Plan  string
+}
+
+type registryOther struct {
+	Name string
+}
+
+func TestRegister(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	opts := &ModelOptions{
+		Indexes: map[string]string{"Email": "", "Plan": "plan"},
+		Codec:   RawCodec,
+	}
+	if err := Register[registryAccount]("account", opts); err != nil {
+		t.Fatal(err)
+	}
+	// registering again replaces the options
+	if err := Register[*registryAccount]("account", opts); err != nil {
+		t.Errorf("expected registering again to succeed but got %v", err)
+	}
+	if err := Register[registryOther]("account", nil); !errors.Is(err, ErrAmbiguousModel) {
+		t.Errorf("expected ErrAmbiguousModel but got %v", err)
+	}
+	if err := Register[string]("text", nil); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("expected ErrInvalidModel but got %v", err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSet(&registryAccount{Email: "a@x.io", Plan: "pro"}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		if ToModelName(&registryAccount{}) != "account" || !txn.Has("account:1") {
+			t.Error("expected the registered name to be used")
+		}
+		if ids, _ := txn.IndexList(&registryAccount{}, "plan", "pro"); len(ids) != 1 {
+			t.Errorf("unexpected index: %v", ids)
+		}
+		if ids, _ := txn.IndexList(&registryAccount{}, "Email", "a@x.io"); len(ids) != 1 {
+			t.Errorf("unexpected index: %v", ids)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetStrictModels(true)
+	defer SetStrictModels(false)
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSet(&registryOther{Name: "x"}, 1)
+	})
+	if !errors.Is(err, ErrUnregisteredModel) {
+		t.Errorf("expected ErrUnregisteredModel but got %v", err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		_, err := txn.ModelGet(&registryAccount{}, 1)
+		return err
+	}, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// the index functions return the error, the functions without an error result return zero
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.IndexAdd(&registryOther{}, "Name", "x", 1); !errors.Is(err, ErrUnregisteredModel) {
+			t.Errorf("expected ErrUnregisteredModel but got %v", err)
+		}
+		if _, err := txn.IndexList(&registryOther{}, "Name", "x"); !errors.Is(err, ErrUnregisteredModel) {
+			t.Errorf("expected ErrUnregisteredModel but got %v", err)
+		}
+		// the names derived from the values are rejected too
+		if _, err := txn.IndexList("registry_account", "Name", "x"); !errors.Is(err, ErrInvalidModel) {
+			t.Errorf("expected ErrInvalidModel but got %v", err)
+		}
+		if n := txn.ModelTotal(&registryOther{}); n != 0 {
+			t.Errorf("unexpected total: %d", n)
+		}
+		if n := txn.ModelTotal("registry_account"); n != 0 {
+			t.Errorf("unexpected total: %d", n)
+		}
+		if n := txn.ModelTotal(&registryAccount{}); n != 1 {
+			t.Errorf("unexpected total: %d", n)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err := db.Sequence(&registryOther{}).Next(); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("expected ErrInvalidModel but got %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRefNotFound   = errors.New("referenced model not found")
+	ErrRefRestricted = errors.New("the model is referenced")
+)
+
+// RefPolicy is what ModelDel does with the models referencing the deleted one, set by the tag `db:"ref=User,on_delete=cascade"`.
+// The referencing models must be registered for cascade and set_null, their types are needed to update them.
+// A soft deletion only checks the restrictions, the other policies run when the model is purged.
+type RefPolicy string
+
+const (
+	RefRestrict RefPolicy = "restrict" // the deletion fails, the default
+	RefCascade  RefPolicy = "cascade"  // the referencing models are deleted
+	RefSetNull  RefPolicy = "set_null" // the reference is cleared
+)
+
+type refField struct {
+	index  int
+	name   string // the field name
+	target string // the name of the referenced model
+	policy RefPolicy
+}
+
+// modelRefs returns the fields with the tag `db:"ref=Model"`, which hold ids or slices of ids
+func modelRefs(t reflect.Type) (list []refField) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get(tagName)
+		targets := tagValues(tag, "ref")
+		if len(targets) == 0 {
+			continue
+		}
+		policy := RefRestrict
+		if values := tagValues(tag, "on_delete"); len(values) > 0 {
+			policy = RefPolicy(strings.ReplaceAll(values[0], "-", "_"))
+		}
+		list = append(list, refField{index: i, name: field.Name, target: ToSnake(targets[0]), policy: policy})
+	}
+	return
+}
+
+// refIDs returns the referenced ids of the field, the zero values are not references
+func refIDs(field reflect.Value) (ids []string) {
+	switch field.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			ids = append(ids, refIDs(field.Index(i))...)
+		}
+	case reflect.Pointer, reflect.Interface:
+		if !field.IsNil() {
+			ids = refIDs(field.Elem())
+		}
+	default:
+		if field.IsValid() && !field.IsZero() {
+			ids = []string{fmt.Sprintf("%v", field.Interface())}
+		}
+	}
+	return
+}
+
+// clearRef removes the ids matched by match from the field
+func clearRef(field reflect.Value, match func(id string) bool) {
+	switch field.Kind() {
+	case reflect.Slice:
+		kept := reflect.MakeSlice(field.Type(), 0, field.Len())
+		for i := 0; i < field.Len(); i++ {
+			if ids := refIDs(field.Index(i)); len(ids) != 1 || !match(ids[0]) {
+				kept = reflect.Append(kept, field.Index(i))
+			}
+		}
+		field.Set(kept)
+	default:
+		if ids := refIDs(field); len(ids) == 1 && match(ids[0]) {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+}
+
+// refKey is the key of the reverse index, the value is the policy
+func refKey(target string, targetID any, modelName, field string, id any) string {
+	return fmt.Sprintf("_ref:%s:%v:%s:%s:%v", target, targetID, modelName, field, id)
+}
+
+// modelRefKeys returns the reverse index keys of the references of the model and their policies
+func (txn *Txn) modelRefKeys(modelName string, id, model any) map[string]RefPolicy {
+	t := modelType(model)
+	if t == nil {
+		return nil
+	}
+	refs := modelRefs(t)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	keys := map[string]RefPolicy{}
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	for _, ref := range refs {
+		for _, refID := range refIDs(v.Field(ref.index)) {
+			_, targetID := txn.modelKey(ref.target, refID)
+			keys[refKey(ref.target, targetID, modelName, ref.name, id)] = ref.policy
+		}
+	}
+	return keys
+}
+
+// syncRefs checks the references of the model and updates the reverse index, model is nil when it is deleted
+func (txn *Txn) syncRefs(modelName string, id, old, model any) error {
+	oldKeys := map[string]RefPolicy{}
+	if old != nil {
+		oldKeys = txn.modelRefKeys(modelName, id, old)
+	}
+	var newKeys map[string]RefPolicy
+	if model != nil {
+		newKeys = txn.modelRefKeys(modelName, id, model)
+	}
+
+	for key := range oldKeys {
+		if _, ok := newKeys[key]; ok {
+			continue
+		}
+		if err := txn.Del(key); err != nil {
+			return err
+		}
+	}
+	if len(newKeys) == 0 {
+		return nil
+	}
+
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	for _, ref := range modelRefs(v.Type()) {
+		for _, refID := range refIDs(v.Field(ref.index)) {
+			key, targetID := txn.modelKey(ref.target, refID)
+			if !txn.Has(key) || txn.isDeleted(ref.target, targetID) {
+				return errors.Wrapf(ErrRefNotFound, "model: %s, id: %v, field: %s, key: %s", modelName, id, ref.name, key)
+			}
+		}
+	}
+	for key, policy := range newKeys {
+		if oldPolicy, ok := oldKeys[key]; ok && oldPolicy == policy {
+			continue
+		}
+		if err := txn.Set(key, string(policy)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveRefs moves the reverse index keys of the model to the new id, the keys of the models referencing it
+// and the keys of its own references. The references to the same model are also looked up by the sortable ids,
+// their targets may be moved already by ModelMigrateSortableID.
+func (txn *Txn) moveRefs(modelName string, model any, id, newID string) error {
+	prefix := fmt.Sprintf("_ref:%s:%s:", modelName, id)
+	var keys []string
+	err := txn.List(prefix, func(key string, value []byte) (bool, error) {
+		keys = append(keys, key)
+		return false, nil
+	}, &ListOption{KeyOnly: true})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := moveKey(txn, key, fmt.Sprintf("_ref:%s:%s:%s", modelName, newID, strings.TrimPrefix(key, prefix))); err != nil {
+			return err
+		}
+	}
+
+	t := modelType(model)
+	if t == nil {
+		return nil
+	}
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	for _, ref := range modelRefs(t) {
+		for _, refID := range refIDs(v.Field(ref.index)) {
+			_, targetID := txn.modelKey(ref.target, refID)
+			targetIDs := []any{targetID}
+			if n, err := strconv.ParseInt(refID, 10, 64); err == nil && n >= 0 && ref.target == modelName {
+				targetIDs = append(targetIDs, SortableID(n))
+			}
+			for _, targetID := range targetIDs {
+				if err := moveKey(txn, refKey(ref.target, targetID, modelName, ref.name, id), refKey(ref.target, targetID, modelName, ref.name, newID)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type referrer struct {
+	modelName string
+	field     string
+	id        string
+	policy    RefPolicy
+}
+
+// referrers returns the models referencing the model
+func (txn *Txn) referrers(prefix string) (list []referrer, err error) {
+	err = txn.List(prefix, func(key string, value []byte) (bool, error) {
+		parts := strings.SplitN(strings.TrimPrefix(key, prefix), ":", 3)
+		if len(parts) != 3 {
+			return false, nil
+		}
+		list = append(list, referrer{modelName: parts[0], field: parts[1], id: parts[2], policy: RefPolicy(value)})
+		return false, nil
+	})
+	return
+}
+
+// applyRefPolicies runs the delete policies of the models referencing the deleted model,
+// only the restrictions are checked when checkOnly is true, such as for a soft deletion.
+// The referencing models being deleted by the transaction are skipped.
+func (txn *Txn) applyRefPolicies(modelName string, id any, checkOnly bool) error {
+	all, err := txn.referrers(fmt.Sprintf("_ref:%s:%v:", modelName, id))
+	if err != nil {
+		return err
+	}
+	list := all[:0]
+	for _, r := range all {
+		if key, _ := txn.modelKey(r.modelName, r.id); !txn.deleting[key] {
+			list = append(list, r)
+		}
+	}
+
+	for _, r := range list {
+		if r.policy != RefRestrict {
+			continue
+		}
+		// the soft deleted models do not keep the model
+		if !txn.isDeleted(r.modelName, r.id) {
+			return errors.Wrapf(ErrRefRestricted, "model: %s, id: %v, referenced by %s:%s", modelName, id, r.modelName, r.id)
+		}
+	}
+	if checkOnly {
+		return nil
+	}
+
+	for _, r := range list {
+		if r.policy == RefRestrict {
+			continue
+		}
+		t, ok := registeredType(r.modelName)
+		if !ok {
+			return errors.Wrapf(ErrUnregisteredModel, "the policy %s of %s needs the registered model %s", r.policy, modelName, r.modelName)
+		}
+		m := reflect.New(t).Interface()
+
+		switch r.policy {
+		case RefCascade:
+			if err := txn.ModelDel(m, r.id); err != nil {
+				return err
+			}
+		case RefSetNull:
+			if err := txn.loadModel(r.modelName, r.id, m, true); err != nil {
+				if errors.Is(err, ErrKeyNotFound) {
+					continue
+				}
+				return err
+			}
+			field := reflect.ValueOf(m).Elem().FieldByName(r.field)
+			if !field.IsValid() {
+				continue
+			}
+			// the stored ids may be in another form of the key, such as "1" of the sortable id "a1"
+			clearRef(field, func(refID string) bool {
+				_, targetID := txn.modelKey(modelName, refID)
+				return fmt.Sprintf("%v", targetID) == fmt.Sprintf("%v", id)
+			})
+			if err := txn.ModelSet(m, r.id); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("unknown delete policy %s of %s:%s", r.policy, r.modelName, r.field)
+		}
+	}
+	return nil
+}
+
+// ModelReferrers returns the ids of the models referencing the id by the field tagged `db:"ref=Model"`,
+// such as the orders of a user
+func (txn *Txn) ModelReferrers(model any, field string, refID any) (ids []string, err error) {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return nil, err
+	}
+	t := modelType(model)
+	if t == nil {
+		return nil, nil
+	}
+
+	for _, ref := range modelRefs(t) {
+		if ref.name != field && ToSnake(ref.name) != ToSnake(field) {
+			continue
+		}
+		_, targetID := txn.modelKey(ref.target, refID)
+		prefix := fmt.Sprintf("_ref:%s:%v:%s:%s:", ref.target, targetID, modelName, ref.name)
+		hidden := !txn.includeDeleted && txn.hasDeleted()
+		err = txn.List(prefix, func(key string, value []byte) (bool, error) {
+			id := strings.TrimPrefix(key, prefix)
+			if hidden && txn.isDeleted(modelName, id) {
+				return false, nil
+			}
+			ids = append(ids, id)
+			return false, nil
+		}, &ListOption{KeyOnly: true})
+		return
+	}
+	return nil, errors.Errorf("field %s of %s has no ref tag", field, modelName)
+}
@@ -0,0 +1,367 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type relUser struct {
+	Name string
+}
+
+type relOrder struct {
+	UserID string `db:"ref=rel_user"`
+}
+
+type relComment struct {
+	UserID string `db:"ref=RelUser,on_delete=cascade"`
+}
+
+type relTicket struct {
+	UserIDs []string `db:"ref=RelUser,on_delete=set-null"`
+}
+
+type relTarget struct {
+	Name string
+}
+
+type relLink struct {
+	TargetID  string   `db:"ref=RelTarget,on_delete=set_null"`
+	TargetIDs []string `db:"ref=RelTarget,on_delete=set_null"`
+}
+
+type relNode struct {
+	Parent string `db:"ref=RelNode,on_delete=cascade"`
+}
+
+type relAuthor struct {
+	Name      string
+	DeletedAt time.Time `db:"soft_delete"`
+}
+
+type relPost struct {
+	AuthorID string `db:"ref=RelAuthor,on_delete=cascade"`
+}
+
+func TestRelations(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// the types of the models with the policies cascade and set_null are registered
+	if err := Register[relComment]("rel_comment", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register[relTicket]("rel_ticket", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSet(&relOrder{UserID: "42"}, 1)
+	})
+	if !errors.Is(err, ErrRefNotFound) {
+		t.Fatalf("expected ErrRefNotFound but got %v", err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		for _, id := range []string{"41", "42"} {
+			if err := txn.ModelSet(&relUser{Name: id}, id); err != nil {
+				return err
+			}
+		}
+		for i, m := range []any{&relOrder{UserID: "42"}, &relOrder{UserID: "42"}, &relComment{UserID: "42"}, &relTicket{UserIDs: []string{"41", "42"}}} {
+			if err := txn.ModelSet(m, i+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		ids, err := txn.ModelReferrers(&relOrder{}, "UserID", 42)
+		if err != nil {
+			return err
+		}
+		if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+			t.Errorf("unexpected referrers: %v", ids)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the orders restrict the deletion
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelDel(&relUser{}, 42)
+	})
+	if !errors.Is(err, ErrRefRestricted) {
+		t.Fatalf("expected ErrRefRestricted but got %v", err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		// moving an order updates the reverse index
+		if err := txn.ModelSet(&relOrder{UserID: "41"}, 1); err != nil {
+			return err
+		}
+		if err := txn.ModelDel(&relOrder{}, 2); err != nil {
+			return err
+		}
+		return txn.ModelDel(&relUser{}, 42)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if txn.Has("rel_comment:3") {
+			t.Error("expected the comment to be deleted")
+		}
+		m, err := txn.ModelGet(&relTicket{}, 4)
+		if err != nil {
+			return err
+		}
+		if ids := m.(*relTicket).UserIDs; len(ids) != 1 || ids[0] != "41" {
+			t.Errorf("expected the reference to be cleared: %v", ids)
+		}
+		if ids, _ := txn.ModelReferrers(&relOrder{}, "user_id", 41); len(ids) != 1 {
+			t.Errorf("unexpected referrers: %v", ids)
+		}
+		var refs int
+		txn.List("_ref:rel_user:42:", func(key string, value []byte) (bool, error) {
+			refs++
+			return false, nil
+		})
+		if refs != 0 {
+			t.Errorf("expected the reverse index to be empty but got %d keys", refs)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelationsCycle(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := Register[relNode]("rel_node", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 -> 2 -> 3 -> 1
+	err = db.Txn(func(txn *Txn) error {
+		for _, n := range []struct{ id, parent string }{{"1", ""}, {"2", "1"}, {"3", "2"}, {"1", "3"}} {
+			if err := txn.ModelSet(&relNode{Parent: n.parent}, n.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelDel(&relNode{}, 2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		for _, id := range []int{1, 2, 3} {
+			if txn.Has(fmt.Sprintf("rel_node:%d", id)) {
+				t.Errorf("expected the node %d to be deleted", id)
+			}
+		}
+		var refs int
+		txn.List("_ref:", func(key string, value []byte) (bool, error) {
+			refs++
+			return false, nil
+		})
+		if refs != 0 {
+			t.Errorf("expected the reverse index to be empty but got %d keys", refs)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelationsSoftDelete(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := Register[relPost]("rel_post", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.ModelSet(&relAuthor{Name: "a"}, 1); err != nil {
+			return err
+		}
+		if err := txn.ModelSet(&relPost{AuthorID: "1"}, 1); err != nil {
+			return err
+		}
+		return txn.ModelDel(&relAuthor{}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the post is kept, so restoring the author keeps its posts
+	err = db.Txn(func(txn *Txn) error {
+		if !txn.Has("rel_post:1") {
+			t.Error("expected the post to be kept by the soft deletion")
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.Purge(&relAuthor{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 purged model but got %d", n)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		if txn.Has("rel_post:1") {
+			t.Error("expected the post to be deleted by the purge")
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelationsMove(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.ModelSet(&relUser{Name: "a"}, 7); err != nil {
+			return err
+		}
+		return txn.ModelSet(&relOrder{UserID: "7"}, 3)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both sides of the reference are moved to the sortable ids
+	if err := db.ModelMigrateSortableID(&relOrder{}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ModelMigrateSortableID(&relUser{}, 10); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		if key := refKey("rel_user", SortableID(7), "rel_order", "UserID", SortableID(3)); !txn.Has(key) {
+			t.Errorf("expected the key %s", key)
+		}
+		if ids, _ := txn.ModelReferrers(&relOrder{}, "UserID", 7); len(ids) != 1 || ids[0] != SortableID(3) {
+			t.Errorf("unexpected referrers: %v", ids)
+		}
+		if err := txn.ModelDel(&relUser{}, 7); !errors.Is(err, ErrRefRestricted) {
+			t.Errorf("expected ErrRefRestricted but got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Migrate(Migrations{{ID: 1, Chunked: func(m *Migrator) error {
+		if err := m.RenameModel("rel_order", "rel_purchase"); err != nil {
+			return err
+		}
+		return m.RenameModel("rel_user", "rel_member")
+	}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		var keys []string
+		txn.List("_ref:", func(key string, value []byte) (bool, error) {
+			keys = append(keys, key)
+			return false, nil
+		})
+		if key := refKey("rel_member", SortableID(7), "rel_purchase", "UserID", SortableID(3)); len(keys) != 1 || keys[0] != key {
+			t.Errorf("expected the key %s but got %v", key, keys)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelationsSetNullSortableID(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := Register[relLink]("rel_link", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new model gets sortable ids, the links store the readable form
+	var id string
+	err = db.Txn(func(txn *Txn) (err error) {
+		if id, err = txn.ModelNewID(&relTarget{}); err != nil {
+			return err
+		}
+		if err := txn.ModelSet(&relTarget{Name: "a"}, id); err != nil {
+			return err
+		}
+		return txn.ModelSet(&relLink{TargetID: FormatID(id), TargetIDs: []string{FormatID(id), id}}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == FormatID(id) {
+		t.Fatalf("expected a sortable id but got %s", id)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelDel(&relTarget{}, id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		m, err := txn.ModelGet(&relLink{}, 1)
+		if err != nil {
+			return err
+		}
+		if l := m.(*relLink); l.TargetID != "" || len(l.TargetIDs) != 0 {
+			t.Errorf("expected the references to be cleared: %+v", l)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
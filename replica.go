@@ -0,0 +1,412 @@
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	shipBatchSize = 1000
+	shipInterval  = 100 * time.Millisecond
+)
+
+var (
+	ErrPromoted = errors.New("the replica is promoted")
+
+	replicaBucket     = []byte("_replica")
+	replicaAppliedKey = []byte("applied")
+)
+
+// LogBatch is a batch of log entries shipped from the primary to a replica
+type LogBatch struct {
+	Head    uint64     `json:"head"` // the last sequence of the primary
+	Entries []LogEntry `json:"entries"`
+}
+
+type LogSender interface {
+	Send(batch *LogBatch) error
+}
+
+type LogReceiver interface {
+	// Receive blocks until a batch arrives, io.EOF is returned when the transport is closed
+	Receive(ctx context.Context) (*LogBatch, error)
+}
+
+// ShipLog sends the change log from the sequence from (included) until ctx is done.
+// The primary must be opened with Options.ChangeLog.
+func (t *DB) ShipLog(ctx context.Context, sender LogSender, from uint64) error {
+	ticker := time.NewTicker(shipInterval)
+	defer ticker.Stop()
+
+	for {
+		batch := &LogBatch{}
+		err := t.view(func(tx *bolt.Tx) error {
+			if first := firstLogSeq(tx); first > from {
+				return errors.Wrapf(ErrLogTruncated, "from: %d, first: %d", from, first)
+			}
+			if b := tx.Bucket(logBucket); b != nil {
+				batch.Head = b.Sequence()
+			}
+			return readLog(tx, from, shipBatchSize, func(e LogEntry) (bool, error) {
+				batch.Entries = append(batch.Entries, e)
+				return false, nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(batch.Entries) > 0 {
+			if err := sender.Send(batch); err != nil {
+				return err
+			}
+			from = batch.Entries[len(batch.Entries)-1].Seq + 1
+			if len(batch.Entries) == shipBatchSize {
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Replica applies the change log of a primary to another database file,
+// the database can be read by the normal api until it is promoted.
+type Replica struct {
+	db *DB
+
+	mu       sync.Mutex
+	applied  uint64
+	head     uint64
+	lastTime time.Time
+	promoted bool
+
+	sweepInterval time.Duration // the interval of the sweeper after Promote
+}
+
+// OpenReplica opens the replica database at path. When snapshot is not nil, the file is replaced
+// by the snapshot (written by Backup of the primary), and the replica catches up from it.
+// The options are the ones of the database after Promote, nil uses DefaultOptions.
+// The sweeper does not run and ReadOnly, ChangeLog and Migrations are ignored until then.
+func OpenReplica(path string, snapshot io.Reader, options *Options) (*Replica, error) {
+	if snapshot != nil {
+		err := writeFileAtomic(path, func(w io.Writer) error {
+			_, err := io.Copy(w, snapshot)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := DefaultOptions
+	if options != nil {
+		opts = *options
+	}
+	sweepInterval := opts.SweepInterval
+
+	// the primary purges the expired keys and ships the deletes
+	opts.ReadOnly, opts.ChangeLog, opts.SweepInterval, opts.Migrations = false, false, 0, nil
+	db, err := Open(path, &opts)
+	if err != nil {
+		return nil, err
+	}
+	db.readOnly.Store(true)
+
+	r := &Replica{db: db, sweepInterval: sweepInterval}
+	err = db.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(replicaBucket)
+		if err != nil {
+			return err
+		}
+		if v := b.Get(replicaAppliedKey); len(v) == 8 {
+			r.applied = binary.BigEndian.Uint64(v)
+		} else if lb := tx.Bucket(logBucket); lb != nil {
+			// the snapshot contains the log up to its sequence
+			r.applied = lb.Sequence()
+		}
+		r.head = r.applied
+		return b.Put(replicaAppliedKey, seqKey(r.applied))
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// DB returns the database of the replica, writes fail with ErrReadOnly until it is promoted
+func (r *Replica) DB() *DB {
+	return r.db
+}
+
+// Applied returns the sequence of the last applied entry, ship the log from Applied()+1
+func (r *Replica) Applied() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.applied
+}
+
+type ReplicaStatus struct {
+	Applied uint64        // the sequence of the last applied entry
+	Head    uint64        // the last sequence of the primary known by the replica
+	Lag     uint64        // the number of entries behind the primary
+	Delay   time.Duration // the age of the last applied entry when the replica is behind
+}
+
+func (r *Replica) Status() ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := ReplicaStatus{Applied: r.applied, Head: r.head}
+	if r.head > r.applied {
+		s.Lag = r.head - r.applied
+		if !r.lastTime.IsZero() {
+			s.Delay = r.db.now().Sub(r.lastTime)
+		}
+	}
+	return s
+}
+
+// Apply applies the entries after the applied sequence in one write
+func (r *Replica) Apply(batch *LogBatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.promoted {
+		return ErrPromoted
+	}
+
+	applied := r.applied
+	var lastTime time.Time
+	var txn *Txn
+	err := r.db.update(func(tx *bolt.Tx) (err error) {
+		txn = &Txn{t: tx, db: r.db, record: r.db.watching()}
+		applied, lastTime, err = txn.applyLog(batch.Entries, applied)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(replicaBucket).Put(replicaAppliedKey, seqKey(applied))
+	})
+	if err != nil {
+		return err
+	}
+
+	if applied > r.applied {
+		r.applied = applied
+		r.lastTime = lastTime
+	}
+	if batch.Head > r.head {
+		r.head = batch.Head
+	}
+	if r.head < r.applied {
+		r.head = r.applied
+	}
+	r.db.publish(txn.events)
+	return nil
+}
+
+// applyLog applies the entries of another database after the sequence applied,
+// the entries are kept in the log, so the sequence continues after them
+func (txn *Txn) applyLog(entries []LogEntry, applied uint64) (uint64, time.Time, error) {
+	var lastTime time.Time
+	lb, err := txn.t.CreateBucketIfNotExists(logBucket)
+	if err != nil {
+		return applied, lastTime, err
+	}
+
+	for _, e := range entries {
+		if e.Seq <= applied {
+			continue
+		}
+		if e.Seq != applied+1 {
+			return applied, lastTime, errors.Errorf("missing log entries, applied: %d, next: %d", applied, e.Seq)
+		}
+
+		switch e.Type {
+		case EventPut:
+			err = txn.put(e.Key, e.Raw)
+		case EventDelete:
+			err = txn.del(e.Key)
+		default:
+			err = errors.Wrapf(ErrInvalidLogEntry, "seq: %d, type: %d", e.Seq, e.Type)
+		}
+		if err != nil {
+			return applied, lastTime, err
+		}
+
+		if err := lb.Put(seqKey(e.Seq), encodeLogEntry(e)); err != nil {
+			return applied, lastTime, err
+		}
+		if err := lb.SetSequence(e.Seq); err != nil {
+			return applied, lastTime, err
+		}
+		applied = e.Seq
+		lastTime = e.Time
+	}
+	return applied, lastTime, nil
+}
+
+// Run applies the batches from the receiver until ctx is done, the receiver is closed or the replica is promoted
+func (r *Replica) Run(ctx context.Context, receiver LogReceiver) error {
+	for {
+		batch, err := receiver.Receive(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := r.Apply(batch); err != nil {
+			if errors.Is(err, ErrPromoted) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Promote stops applying the log and makes the database writable, it records its own change log from then on
+func (r *Replica) Promote() *DB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.promoted {
+		r.promoted = true
+		r.db.changeLog.Store(true)
+		r.db.readOnly.Store(false)
+		r.db.startSweeper(r.sweepInterval)
+	}
+	return r.db
+}
+
+func (r *Replica) Close() {
+	r.db.Close()
+}
+
+type streamSender struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewStreamSender writes the batches as json lines, it works with io.Pipe and network connections
+func NewStreamSender(w io.Writer) LogSender {
+	return &streamSender{encoder: json.NewEncoder(w)}
+}
+
+func (s *streamSender) Send(batch *LogBatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(batch)
+}
+
+type streamReceiver struct {
+	decoder *json.Decoder
+}
+
+// NewStreamReceiver reads the batches written by a stream sender, Receive returns io.EOF at the end of the stream.
+// The read is not interrupted by ctx, close the reader to stop it.
+func NewStreamReceiver(r io.Reader) LogReceiver {
+	return &streamReceiver{decoder: json.NewDecoder(r)}
+}
+
+func (s *streamReceiver) Receive(ctx context.Context) (*LogBatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	batch := &LogBatch{}
+	if err := s.decoder.Decode(batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// DirTransport ships the batches as files in a directory, the files are deleted after they are applied
+type DirTransport struct {
+	dir  string
+	last string // the file received last time
+}
+
+func NewDirTransport(dir string) (*DirTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirTransport{dir: dir}, nil
+}
+
+func (d *DirTransport) Send(batch *LogBatch) error {
+	if len(batch.Entries) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%020d.batch", batch.Entries[0].Seq)
+	return writeFileAtomic(filepath.Join(d.dir, name), func(w io.Writer) error {
+		_, err := w.Write(raw)
+		return err
+	})
+}
+
+func (d *DirTransport) Receive(ctx context.Context) (*LogBatch, error) {
+	// the batch received last time is applied when Receive is called again
+	if d.last != "" {
+		if err := os.Remove(filepath.Join(d.dir, d.last)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		d.last = ""
+	}
+
+	ticker := time.NewTicker(shipInterval)
+	defer ticker.Stop()
+	for {
+		entries, err := os.ReadDir(d.dir)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), ".batch") {
+				names = append(names, e.Name())
+			}
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			raw, err := os.ReadFile(filepath.Join(d.dir, names[0]))
+			if err != nil {
+				return nil, err
+			}
+			batch := &LogBatch{}
+			if err := json.Unmarshal(raw, batch); err != nil {
+				return nil, errors.Wrapf(err, "file: %s", names[0])
+			}
+			d.last = names[0]
+			return batch, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitApplied(t *testing.T, r *Replica, seq uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Applied() < seq {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected applied %d but got %d", seq, r.Applied())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplicaStream(t *testing.T) {
+	dir := t.TempDir()
+	primary, err := Open(filepath.Join(dir, "primary"), &Options{ChangeLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+
+	err = primary.Txn(func(txn *Txn) error {
+		return txn.Set("user:1", "alice")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the replica starts from a snapshot and catches up from the log after it
+	var snapshot bytes.Buffer
+	if _, err := primary.Backup(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	replica, err := OpenReplica(filepath.Join(dir, "replica"), &snapshot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go primary.ShipLog(ctx, NewStreamSender(pw), replica.Applied()+1)
+	done := make(chan error, 1)
+	go func() { done <- replica.Run(ctx, NewStreamReceiver(pr)) }()
+
+	err = primary.Txn(func(txn *Txn) error {
+		if err := txn.Set("user:2", "bob"); err != nil {
+			return err
+		}
+		return txn.Del("user:1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitApplied(t, replica, primary.LastLogSeq())
+
+	err = replica.DB().Txn(func(txn *Txn) error {
+		if txn.Has("user:1") {
+			t.Error("expected user:1 to be deleted")
+		}
+		if v, err := txn.Get("user:2"); err != nil || string(v) != "bob" {
+			t.Errorf("expected bob but got %v, %v", v, err)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := replica.Status(); s.Lag != 0 || s.Head != primary.LastLogSeq() {
+		t.Errorf("unexpected status: %+v", s)
+	}
+
+	err = replica.DB().Txn(func(txn *Txn) error {
+		return txn.Set("user:3", "carol")
+	})
+	if !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly but got %v", err)
+	}
+
+	// after the promotion the replica is writable and continues the log
+	cancel()
+	pw.Close()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	last := replica.Applied()
+
+	// a writer using the database while it is promoted
+	written := make(chan error, 1)
+	go func() {
+		for {
+			err := replica.DB().Txn(func(txn *Txn) error {
+				return txn.Set("user:3", "carol")
+			})
+			if !errors.Is(err, ErrReadOnly) {
+				written <- err
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	db := replica.Promote()
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if seq := db.LastLogSeq(); seq <= last {
+		t.Errorf("expected the log to continue after %d but got %d", last, seq)
+	}
+	if err := replica.Apply(&LogBatch{}); !errors.Is(err, ErrPromoted) {
+		t.Errorf("expected ErrPromoted but got %v", err)
+	}
+}
+
+func TestReplicaDirTransport(t *testing.T) {
+	dir := t.TempDir()
+	primary, err := Open(filepath.Join(dir, "primary"), &Options{ChangeLog: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+
+	transport, err := NewDirTransport(filepath.Join(dir, "ship"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica, err := OpenReplica(filepath.Join(dir, "replica"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go primary.ShipLog(ctx, transport, replica.Applied()+1)
+	go replica.Run(ctx, transport)
+
+	for i := 1; i <= 3; i++ {
+		err = primary.Txn(func(txn *Txn) error {
+			return txn.Set(K("n", i).String(), i)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitApplied(t, replica, primary.LastLogSeq())
+
+	n := 0
+	err = replica.DB().ListKey(K("n"), func(key string, value []byte) (bool, error) {
+		n++
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 keys but got %d", n)
+	}
+
+	// an entry after a gap is rejected
+	err = replica.Apply(&LogBatch{Entries: []LogEntry{{Seq: replica.Applied() + 2, Type: EventPut, Key: "n:x"}}})
+	if err == nil {
+		t.Error("expected an error for missing entries")
+	}
+}
+
+func TestReplicaPromoteOptions(t *testing.T) {
+	replica, err := OpenReplica(filepath.Join(t.TempDir(), "replica"), nil, &Options{SweepInterval: 10 * time.Millisecond, LogMaxEntries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	db := replica.Promote()
+	for i := 1; i <= 5; i++ {
+		err = db.Txn(func(txn *Txn) error {
+			return txn.Set(K("n", i).String(), i)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the sweeper of the promoted database truncates the log by the options
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n := 0
+		err := db.ReadLog(0, 0, func(e LogEntry) (bool, error) {
+			n++
+			return false, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 0 && n <= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the log to be truncated but it has %d entries", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
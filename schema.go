@@ -0,0 +1,312 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	json "github.com/goccy/go-json"
+	"github.com/pkg/errors"
+)
+
+var errStopped = errors.New("the database is closed")
+
+// the aliases set by SetFieldAliases, by the type of the model and the field name
+var fieldAliasRegistry = struct {
+	sync.RWMutex
+	types map[reflect.Type]map[string][]string
+}{types: map[reflect.Type]map[string][]string{}}
+
+// SetFieldAliases sets the old json keys of the fields of the model, like the tag `db:"was=OldName"`.
+// The aliases are keyed by the field names, nil removes them.
+func SetFieldAliases(model any, aliases map[string][]string) {
+	t := modelType(model)
+	if t == nil {
+		return
+	}
+
+	fieldAliasRegistry.Lock()
+	defer fieldAliasRegistry.Unlock()
+	if aliases == nil {
+		delete(fieldAliasRegistry.types, t)
+		return
+	}
+	fieldAliasRegistry.types[t] = aliases
+}
+
+func modelType(model any) reflect.Type {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+type fieldAlias struct {
+	index   int
+	name    string   // the json key of the field
+	aliases []string // the old json keys
+}
+
+// splitTag splits the db tag into its options, the commas in brackets, braces and quotes
+// belong to the values, such as `db:"default=[1,2]"`
+func splitTag(tag string) (options []string) {
+	tag = strings.Trim(tag, ", ;")
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(tag); i++ {
+		switch c := tag[i]; {
+		case quoted:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quoted = false
+			}
+		case c == '"':
+			quoted = true
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth <= 0:
+			options = append(options, tag[start:i])
+			start = i + 1
+		}
+	}
+	return append(options, tag[start:])
+}
+
+// tagValues returns the values of the option in the db tag, such as "A" of `db:"was=A"`
+func tagValues(tag, option string) (values []string) {
+	for _, v := range splitTag(tag) {
+		name, value, ok := strings.Cut(strings.TrimSpace(v), "=")
+		if ok && strings.TrimSpace(name) == option {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+	return
+}
+
+// tagHas returns whether the db tag has the option, such as "created_at" of `db:"created_at"`
+func tagHas(tag, option string) bool {
+	for _, v := range splitTag(tag) {
+		if strings.TrimSpace(v) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonName returns the json key of the field
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func modelAliases(t reflect.Type) (list []fieldAlias) {
+	fieldAliasRegistry.RLock()
+	registered := fieldAliasRegistry.types[t]
+	fieldAliasRegistry.RUnlock()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		aliases := append(tagValues(field.Tag.Get(tagName), "was"), registered[field.Name]...)
+		if len(aliases) > 0 {
+			list = append(list, fieldAlias{index: i, name: jsonName(field), aliases: aliases})
+		}
+	}
+	return
+}
+
+type fieldDefault struct {
+	index   int
+	name    string   // the json key of the field
+	aliases []string // the old json keys
+	value   string
+}
+
+// modelDefaults returns the fields with the tag `db:"default=value"`
+func modelDefaults(t reflect.Type) (list []fieldDefault) {
+	fieldAliasRegistry.RLock()
+	registered := fieldAliasRegistry.types[t]
+	fieldAliasRegistry.RUnlock()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get(tagName)
+		values := tagValues(tag, "default")
+		if len(values) == 0 {
+			continue
+		}
+		aliases := append(tagValues(tag, "was"), registered[field.Name]...)
+		list = append(list, fieldDefault{index: i, name: jsonName(field), aliases: aliases, value: values[0]})
+	}
+	return
+}
+
+// checkDefaults returns an error when a default value can not be set to its field
+func checkDefaults(t reflect.Type) error {
+	for _, d := range modelDefaults(t) {
+		if err := setDefault(reflect.New(t).Elem().Field(d.index), d.value); err != nil {
+			return errors.Wrapf(ErrInvalidModel, "type: %s, field: %s, default: %s, %v", t, t.Field(d.index).Name, d.value, err)
+		}
+	}
+	return nil
+}
+
+// setDefault sets the field to the default value, which is json or a plain string
+func setDefault(field reflect.Value, value string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+	return json.Unmarshal([]byte(value), field.Addr().Interface())
+}
+
+// decodeModel unmarshals the stored json into the model, the fields also accept their old json keys,
+// and the fields missing in the document get their default values.
+// It returns whether the document has old keys, so it is upgraded by a write.
+func decodeModel(raw []byte, model any) (old bool, err error) {
+	if err := json.Unmarshal(raw, model); err != nil {
+		return false, err
+	}
+
+	t := modelType(model)
+	if t == nil {
+		return false, nil
+	}
+	aliases := modelAliases(t)
+	defaults := modelDefaults(t)
+	if len(aliases) == 0 && len(defaults) == 0 {
+		return false, nil
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return false, nil
+	}
+	has := func(name string) (json.RawMessage, bool) {
+		if v, ok := doc[name]; ok {
+			return v, true
+		}
+		// json matches the keys without case
+		for k, v := range doc {
+			if strings.EqualFold(k, name) {
+				return v, true
+			}
+		}
+		return nil, false
+	}
+
+	v := reflect.ValueOf(model).Elem()
+	for _, a := range aliases {
+		_, current := has(a.name)
+		for _, alias := range a.aliases {
+			value, ok := has(alias)
+			if !ok {
+				continue
+			}
+			old = true
+			if current {
+				continue
+			}
+			if err := json.Unmarshal(value, v.Field(a.index).Addr().Interface()); err != nil {
+				return old, errors.Wrapf(err, "field: %s, old key: %s", t.Field(a.index).Name, alias)
+			}
+			current = true
+		}
+	}
+
+next:
+	for _, d := range defaults {
+		for _, name := range append([]string{d.name}, d.aliases...) {
+			if _, ok := has(name); ok {
+				continue next
+			}
+		}
+		if err := setDefault(v.Field(d.index), d.value); err != nil {
+			return old, errors.Wrapf(err, "field: %s, default: %s", t.Field(d.index).Name, d.value)
+		}
+	}
+	return old, nil
+}
+
+// unmarshalModel reads the model like Unmarshal, and accepts the old json keys of the fields
+func (txn *Txn) unmarshalModel(key string, model any) error {
+	raw, err := txn.Get(key)
+	if err != nil {
+		return errors.Wrapf(err, "read item, key: %s", key)
+	}
+	if _, err := decodeModel(raw, model); err != nil {
+		return errors.Wrapf(err, "unmarshal, key: %s, raw: %s", key, raw)
+	}
+	return nil
+}
+
+// UpgradeModels rewrites the stored models having old json keys to the current shape in chunks,
+// and returns the number of upgraded models. The indexes are kept, they are built from the decoded values.
+func (t *DB) UpgradeModels(model any, batchSize int) (n int, err error) {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" || NewModel(model) == nil {
+		return 0, err
+	}
+
+	var upgraded int
+	err = t.chunks(modelName+":", "", batchSize, func(txn *Txn, keys []string) error {
+		upgraded = 0
+		select {
+		case <-t.stop:
+			return errStopped
+		default:
+		}
+
+		for _, key := range keys {
+			raw, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			m := NewModel(model)
+			old, err := decodeModel(raw, m)
+			if err != nil || !old {
+				// the models that can not be decoded are reported by Verify
+				continue
+			}
+			if err := txn.saveModel(key, m); err != nil {
+				return err
+			}
+			upgraded++
+		}
+		return nil
+	}, func(keys []string) {
+		n += upgraded
+	})
+	return
+}
+
+// UpgradeModelsInBackground runs UpgradeModels in a goroutine, it stops when the database is closed.
+// The channel receives the result.
+func (t *DB) UpgradeModelsInBackground(model any, batchSize int) <-chan error {
+	ch := make(chan error, 1)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		_, err := t.UpgradeModels(model, batchSize)
+		if errors.Is(err, errStopped) {
+			err = nil
+		}
+		ch <- err
+		close(ch)
+	}()
+	return ch
+}
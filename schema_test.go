@@ -0,0 +1,78 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFieldAliases(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the documents written before the fields were renamed
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.Set("alias_user:1", map[string]any{"FullName": "alice", "mail": "a@x.io"}); err != nil {
+			return err
+		}
+		return txn.Set("alias_user:2", map[string]any{"FullName": "bob", "Email": "b@x.io"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type aliasUser struct {
+		Name  string `db:"was=FullName"`
+		Email string
+	}
+	SetFieldAliases(&aliasUser{}, map[string][]string{"Email": {"mail"}})
+	defer SetFieldAliases(&aliasUser{}, nil)
+
+	err = db.Txn(func(txn *Txn) error {
+		m, err := txn.ModelGet(&aliasUser{}, 1)
+		if err != nil {
+			return err
+		}
+		if u := m.(*aliasUser); u.Name != "alice" || u.Email != "a@x.io" {
+			t.Errorf("unexpected model: %+v", u)
+		}
+		list, err := txn.ModelList(&aliasUser{}, 0, "", false)
+		if err != nil {
+			return err
+		}
+		if len(list) != 2 || list[1].(*aliasUser).Name != "bob" {
+			t.Errorf("unexpected list: %+v", list)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the documents are rewritten to the current shape
+	n, err := db.UpgradeModels(&aliasUser{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 upgraded models but got %d", n)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		raw, err := txn.Get("alias_user:1")
+		if err != nil {
+			return err
+		}
+		if string(raw) != `{"Name":"alice","Email":"a@x.io"}` {
+			t.Errorf("unexpected document: %s", raw)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-db.UpgradeModelsInBackground(&aliasUser{}, 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const defaultSequenceLease = 100
+
+// Sequence hands out the ids of a model from memory, the ids are leased from "_counter:model" in blocks.
+// Ids of a block that are not used before a crash are skipped, the unused ids are returned on Release.
+// Next must not be called inside a write transaction, because leasing a block needs its own write.
+type Sequence struct {
+	db        *DB
+	modelName string
+	lease     int64
+
+	mu       sync.Mutex
+	next     int64
+	max      int64
+	sortable bool
+	length   int
+	restores int64 // DB.restores when the block was leased
+}
+
+// SetSequenceLease sets the block size of the sequence of the model
+func (t *DB) SetSequenceLease(model any, lease int64) {
+	modelName := modelNameOrEmpty(model)
+	if modelName == "" || lease <= 0 {
+		return
+	}
+
+	t.seqMutex.Lock()
+	defer t.seqMutex.Unlock()
+	if t.seqLeases == nil {
+		t.seqLeases = map[string]int64{}
+	}
+	t.seqLeases[modelName] = lease
+	if s, ok := t.sequences[modelName]; ok {
+		s.mu.Lock()
+		s.lease = lease
+		s.mu.Unlock()
+	}
+}
+
+// Sequence returns the sequence of the model, the sequence is shared by all callers.
+// It is nil for a model rejected by the registry, its Next returns ErrInvalidModel.
+func (t *DB) Sequence(model any) *Sequence {
+	modelName := modelNameOrEmpty(model)
+	if modelName == "" {
+		return nil
+	}
+
+	t.seqMutex.Lock()
+	defer t.seqMutex.Unlock()
+	if s, ok := t.sequences[modelName]; ok {
+		return s
+	}
+
+	lease := t.seqLeases[modelName]
+	if lease <= 0 {
+		lease = defaultSequenceLease
+	}
+	s := &Sequence{db: t, modelName: modelName, lease: lease, next: 1}
+	if t.sequences == nil {
+		t.sequences = map[string]*Sequence{}
+	}
+	t.sequences[modelName] = s
+	return s
+}
+
+// Next returns the next number of the sequence
+func (s *Sequence) Next() (int64, error) {
+	if s == nil {
+		return 0, errors.Wrap(ErrInvalidModel, "the sequence of a model rejected by the registry")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next > s.max || s.restores != s.db.restores.Load() {
+		if err := s.renew(); err != nil {
+			return 0, err
+		}
+	}
+	n := s.next
+	s.next++
+	return n, nil
+}
+
+// NextID returns the next id formatted like ModelNextID
+func (s *Sequence) NextID() (string, error) {
+	n, err := s.Next()
+	if err != nil {
+		return "", err
+	}
+	if s.sortable {
+		return SortableID(n), nil
+	}
+	return PaddingZero(n, s.length), nil
+}
+
+func (s *Sequence) renew() error {
+	var last, restores int64
+	var sortable bool
+	var length int
+	err := s.db.Txn(func(txn *Txn) (err error) {
+		// Restore waits for the transaction, so the block belongs to the file
+		restores = s.db.restores.Load()
+		length = txn.modelIDLength(s.modelName)
+		// a new model gets sortable ids like CounterID
+		if err := txn.markSortableID(s.modelName, length); err != nil {
+			return err
+		}
+		last, err = txn.CounterAdd(fmt.Sprintf("_counter:%s", s.modelName), s.lease)
+		sortable = txn.hasSortableID(s.modelName)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	// only hand out the block after it is committed
+	s.max = last
+	s.next = last - s.lease + 1
+	s.sortable = sortable
+	s.length = length
+	s.restores = restores
+	return nil
+}
+
+// Release returns the unused ids of the block, if no other block was leased after it
+func (s *Sequence) Release() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next > s.max || s.restores != s.db.restores.Load() {
+		return nil
+	}
+	err := s.db.Txn(func(txn *Txn) error {
+		_, err := txn.CounterCompareAndSet(fmt.Sprintf("_counter:%s", s.modelName), s.max, s.next-1)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.max = s.next - 1
+	return nil
+}
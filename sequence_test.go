@@ -0,0 +1,74 @@
+package db
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := New(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type Item struct{}
+	db.SetSequenceLease(&Item{}, 10)
+	seq := db.Sequence(&Item{})
+
+	var mu sync.Mutex
+	seen := map[int64]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 21; j++ {
+				n, err := seq.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if seen[n] {
+					t.Errorf("duplicate id: %d", n)
+				}
+				seen[n] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 105 ids are used from 11 blocks, the rest of the last block is returned on close
+	db.Txn(func(txn *Txn) error {
+		if c := txn.ModelCounter(&Item{}); c != 110 {
+			t.Errorf("unexpected counter: %d", c)
+		}
+		return nil
+	}, true)
+	db.Close()
+
+	db, err = New(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.Txn(func(txn *Txn) error {
+		if c := txn.ModelCounter(&Item{}); c != 105 {
+			t.Errorf("unexpected counter: %d", c)
+		}
+		return nil
+	}, true)
+
+	id, err := db.Sequence(&Item{}).NextID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the new model got sortable ids, so "106" sorts after "99"
+	if id != SortableID(106) {
+		t.Errorf("unexpected id: %s", id)
+	}
+}
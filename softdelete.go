@@ -0,0 +1,198 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The models with a field tagged `db:"soft_delete"` are not removed by ModelDel,
+// the field is set to the time of the deletion and the models are hidden until they are restored.
+// The field is time.Time, *time.Time or an integer of unix seconds, like the timestamps.
+
+// softDeleteField returns the field tagged `db:"soft_delete"` of the model
+func softDeleteField(model any) (reflect.Value, bool) {
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if tagHas(t.Field(i).Tag.Get(tagName), "soft_delete") {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// deletedKey is the key marking the soft deleted model, the value is the time of the deletion
+func deletedKey(modelName string, id any) string {
+	return fmt.Sprintf("_deleted:%s:%v", modelName, id)
+}
+
+// SetIncludeDeleted makes the model functions of the transaction return the soft deleted models
+func (txn *Txn) SetIncludeDeleted(include bool) {
+	txn.includeDeleted = include
+}
+
+// hasDeleted returns whether there may be soft deleted models
+func (txn *Txn) hasDeleted() bool {
+	return txn.t.Bucket([]byte("_deleted")) != nil
+}
+
+// modelHasDeleted returns whether the model has soft deleted models
+func (txn *Txn) modelHasDeleted(modelName string) bool {
+	if !txn.hasDeleted() {
+		return false
+	}
+	found := false
+	txn.List(deletedKey(modelName, ""), func(key string, value []byte) (bool, error) {
+		found = true
+		return true, nil
+	}, &ListOption{KeyOnly: true, Limit: 1})
+	return found
+}
+
+func (txn *Txn) isDeleted(modelName string, id any) bool {
+	return txn.hasDeleted() && txn.Has(deletedKey(modelName, id))
+}
+
+// syncDeleted keeps the mark of the model in line with its soft delete field
+func (txn *Txn) syncDeleted(modelName string, id, model any) error {
+	field, ok := softDeleteField(model)
+	if !ok {
+		return nil
+	}
+	key := deletedKey(modelName, id)
+	if field.IsZero() {
+		if !txn.Has(key) {
+			return nil
+		}
+		return txn.Del(key)
+	}
+	at, ok := getTime(field)
+	if !ok {
+		at = txn.now()
+	}
+	return txn.Set(key, at.Unix())
+}
+
+// softDelete marks the loaded model as deleted
+func (txn *Txn) softDelete(modelName, key string, id, m any, field reflect.Value) error {
+	if !field.IsZero() {
+		return nil
+	}
+	if err := txn.runHooks(HookBeforeDelete, modelName, m); err != nil {
+		return err
+	}
+	old := NewModel(m)
+	reflect.ValueOf(old).Elem().Set(reflect.ValueOf(m).Elem())
+
+	if err := setTime(field, txn.now()); err != nil {
+		return errors.Wrapf(err, "soft delete, key: %s", key)
+	}
+	if err := txn.saveModel(key, m); err != nil {
+		return err
+	}
+	if err := txn.syncDeleted(modelName, id, m); err != nil {
+		return err
+	}
+	if err := txn.recordHistory(modelName, id, m, false); err != nil {
+		return err
+	}
+	if txn.record {
+		txn.annotateModel(key, modelName, old, m)
+	}
+	return txn.runHooks(HookAfterDelete, modelName, m)
+}
+
+// ModelRestore restores the soft deleted model
+func (txn *Txn) ModelRestore(model, id any) error {
+	m := NewModel(model)
+	if m == nil {
+		return nil
+	}
+	modelName, err := modelNameOf(m)
+	if err != nil || modelName == "" {
+		return err
+	}
+	field, ok := softDeleteField(m)
+	if !ok {
+		return nil
+	}
+
+	if err := txn.loadModel(modelName, id, m, true); err != nil {
+		return err
+	}
+	if field.IsZero() {
+		return nil
+	}
+	field.Set(reflect.Zero(field.Type()))
+	return txn.ModelSet(m, id)
+}
+
+// Purge removes the models soft deleted before olderThan ago, their index data and history, and returns the number of them
+func (t *DB) Purge(model any, olderThan time.Duration) (n int, err error) {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" || NewModel(model) == nil {
+		return 0, err
+	}
+
+	before := t.now().Add(-olderThan).Unix()
+	prefix := deletedKey(modelName, "")
+	var purged int
+	err = t.chunks(prefix, "", 0, func(txn *Txn, keys []string) error {
+		purged = 0
+		for _, key := range keys {
+			var at int64
+			if err := txn.Unmarshal(key, &at); err != nil {
+				return err
+			}
+			if at > before {
+				continue
+			}
+
+			id := strings.TrimPrefix(key, prefix)
+			m := NewModel(model)
+			modelKey := modelName + ":" + id
+			if err := txn.unmarshalModel(modelKey, m); err != nil {
+				if !errors.Is(err, ErrKeyNotFound) {
+					return err
+				}
+				// the model was removed
+				if err := txn.Del(key); err != nil {
+					return err
+				}
+				continue
+			}
+			// the policies of the references run when the model is removed
+			if txn.deleting == nil {
+				txn.deleting = map[string]bool{}
+			}
+			txn.deleting[modelKey] = true
+			if err := txn.applyRefPolicies(modelName, id, false); err != nil {
+				return err
+			}
+			if err := txn.removeModel(modelName, modelKey, id, m); err != nil {
+				return err
+			}
+			if err := txn.clearHistory(modelName, id); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	}, func(keys []string) {
+		n += purged
+	})
+	return
+}
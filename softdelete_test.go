@@ -0,0 +1,108 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type softTicket struct {
+	Title     string
+	Status    string     `db:"index"`
+	DeletedAt *time.Time `db:"soft_delete"`
+}
+
+func TestSoftDelete(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	db, err := Open(filepath.Join(t.TempDir(), "db"), &Options{Clock: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		for i := 1; i <= 3; i++ {
+			if err := txn.ModelSet(&softTicket{Title: "t", Status: "open"}, i); err != nil {
+				return err
+			}
+		}
+		if err := txn.ModelDel(&softTicket{}, 1); err != nil {
+			return err
+		}
+		return txn.ModelDel(&softTicket{}, 2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if _, err := txn.ModelGet(&softTicket{}, 1); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("expected ErrKeyNotFound but got %v", err)
+		}
+		if list, _ := txn.ModelList(&softTicket{}, 1, "", false); len(list) != 1 {
+			t.Errorf("unexpected list: %v", list)
+		}
+		if ids, _ := txn.IndexList(&softTicket{}, "Status", "open"); len(ids) != 1 || ids[0] != "3" {
+			t.Errorf("unexpected index list: %v", ids)
+		}
+		if ids, _ := txn.IndexList(&softTicket{}, "Status", "open", &ListOption{IncludeDeleted: true}); len(ids) != 3 {
+			t.Errorf("unexpected index list: %v", ids)
+		}
+		// IndexCount agrees with IndexList, ModelTotal counts the soft deleted models
+		if count := txn.IndexCount(&softTicket{}, "Status", "open"); count != 1 {
+			t.Errorf("unexpected index count: %d", count)
+		}
+		if total := txn.ModelTotal(&softTicket{}); total != 3 {
+			t.Errorf("unexpected total: %d", total)
+		}
+
+		txn.SetIncludeDeleted(true)
+		m, err := txn.ModelGet(&softTicket{}, 1)
+		if err != nil {
+			return err
+		}
+		if at := m.(*softTicket).DeletedAt; at == nil || !at.Equal(now) {
+			t.Errorf("unexpected deleted at: %v", at)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelRestore(&softTicket{}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(48 * time.Hour)
+	n, err := db.Purge(&softTicket{}, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 purged model but got %d", n)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if _, err := txn.ModelGet(&softTicket{}, 1); err != nil {
+			t.Errorf("expected the restored model but got %v", err)
+		}
+		if txn.Has("soft_ticket:2") || txn.Has(deletedKey("soft_ticket", 2)) {
+			t.Error("expected the model to be purged")
+		}
+		if total := txn.ModelTotal(&softTicket{}); total != 2 {
+			t.Errorf("unexpected total: %d", total)
+		}
+		if count := txn.IndexCount(&softTicket{}, "Status", "open"); count != 2 {
+			t.Errorf("unexpected index count: %d", count)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
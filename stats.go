@@ -0,0 +1,157 @@
+package db
+
+import (
+	"sort"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const statsLargestKeys = 10
+
+type Stats struct {
+	FileSize    int64
+	PageSize    int
+	Buckets     []BucketStats
+	Models      []ModelStats
+	LargestKeys []KeyStats // the keys with the largest stored values
+}
+
+type BucketStats struct {
+	Name          string
+	Keys          int
+	Depth         int
+	BranchPages   int
+	LeafPages     int
+	OverflowPages int
+	AllocBytes    int     // the bytes of the pages of the bucket
+	InuseBytes    int     // the bytes used in the pages
+	StoredBytes   int64   // the keys and the stored values
+	LogicalBytes  int64   // the keys and the uncompressed values
+	Compression   float64 // StoredBytes / LogicalBytes
+	LargestKeys   []KeyStats
+}
+
+type KeyStats struct {
+	Bucket string
+	Key    string
+	Stored int // the size of the stored value
+	Size   int // the size of the uncompressed value
+}
+
+type ModelStats struct {
+	Name     string
+	Total    int64          // ModelTotal
+	Counter  int64          // ModelCounter
+	IDLength int            // ModelIdLength
+	Indexes  map[string]int // the index names and their number of distinct values
+}
+
+// Stats scans all buckets in one read transaction, every value is uncompressed to count the logical bytes
+func (t *DB) Stats() (stats Stats, err error) {
+	err = t.view(func(tx *bolt.Tx) error {
+		stats.FileSize = tx.Size()
+		stats.PageSize = tx.DB().Info().PageSize
+
+		err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			bs := b.Stats()
+			s := BucketStats{
+				Name:          string(name),
+				Keys:          bs.KeyN,
+				Depth:         bs.Depth,
+				BranchPages:   bs.BranchPageN,
+				LeafPages:     bs.LeafPageN,
+				OverflowPages: bs.BranchOverflowN + bs.LeafOverflowN,
+				AllocBytes:    bs.BranchAlloc + bs.LeafAlloc,
+				InuseBytes:    bs.BranchInuse + bs.LeafInuse,
+			}
+			err := b.ForEach(func(k, v []byte) error {
+				value := decodeValue(v)
+				s.StoredBytes += int64(len(k) + len(v))
+				s.LogicalBytes += int64(len(k) + len(value))
+				s.LargestKeys = addLargest(s.LargestKeys, KeyStats{s.Name, string(k), len(v), len(value)})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if s.LogicalBytes > 0 {
+				s.Compression = float64(s.StoredBytes) / float64(s.LogicalBytes)
+			}
+			for _, k := range s.LargestKeys {
+				stats.LargestKeys = addLargest(stats.LargestKeys, k)
+			}
+			stats.Buckets = append(stats.Buckets, s)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		stats.Models = modelStats(&Txn{t: tx, db: t})
+		return nil
+	})
+	return
+}
+
+// addLargest keeps the keys with the largest stored values in descending order
+func addLargest(list []KeyStats, k KeyStats) []KeyStats {
+	if len(list) == statsLargestKeys && list[len(list)-1].Stored >= k.Stored {
+		return list
+	}
+	i := sort.Search(len(list), func(i int) bool { return list[i].Stored < k.Stored })
+	list = append(list, KeyStats{})
+	copy(list[i+1:], list[i:])
+	list[i] = k
+	if len(list) > statsLargestKeys {
+		list = list[:statsLargestKeys]
+	}
+	return list
+}
+
+// modelStats discovers the models from the buckets "_total", "_counter", "_id_len" and "_ic"
+func modelStats(txn *Txn) []ModelStats {
+	models := map[string]*ModelStats{}
+	model := func(name string) *ModelStats {
+		m, ok := models[strings.ToLower(name)]
+		if !ok {
+			m = &ModelStats{Name: name, Indexes: map[string]int{}}
+			models[strings.ToLower(name)] = m
+		}
+		return m
+	}
+
+	for _, bucket := range []string{"_total", "_counter", "_id_len"} {
+		txn.List(bucket+":", func(key string, value []byte) (bool, error) {
+			m := model(strings.TrimPrefix(key, bucket+":"))
+			switch bucket {
+			case "_total":
+				m.Total = txn.modelTotal(m.Name)
+			case "_counter":
+				m.Counter = txn.modelCounter(m.Name)
+			case "_id_len":
+				m.IDLength = txn.modelIDLength(m.Name)
+			}
+			return false, nil
+		}, &ListOption{KeyOnly: true})
+	}
+
+	// the keys are "_ic:model:field:value" in lower case
+	txn.List("_ic:", func(key string, value []byte) (bool, error) {
+		parts := strings.SplitN(strings.TrimPrefix(key, "_ic:"), ":", 3)
+		if len(parts) != 3 {
+			return false, nil
+		}
+		if n, _ := txn.CounterGet(key); n > 0 {
+			model(parts[0]).Indexes[parts[1]]++
+		}
+		return false, nil
+	}, &ListOption{KeyOnly: true})
+
+	list := make([]ModelStats, 0, len(models))
+	for _, m := range models {
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
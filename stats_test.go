@@ -0,0 +1,65 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type statsUser struct {
+	Name string `db:"index"`
+	City string `db:"index=city"`
+}
+
+func TestStats(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		for i, name := range []string{"alice", "bob", "carol"} {
+			id := txn.ModelNextID(&statsUser{}, 4)
+			if err := txn.ModelSet(&statsUser{Name: name, City: []string{"paris", "rome"}[i%2]}, id); err != nil {
+				return err
+			}
+		}
+		return txn.Set("blob:1", strings.Repeat("x", 10000))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FileSize == 0 || len(stats.Buckets) == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	var blob *BucketStats
+	for i := range stats.Buckets {
+		if stats.Buckets[i].Name == "blob" {
+			blob = &stats.Buckets[i]
+		}
+	}
+	if blob == nil || blob.Keys != 1 || blob.LogicalBytes != int64(len("blob:1")+10000) || blob.Compression >= 1 {
+		t.Errorf("unexpected bucket stats: %+v", blob)
+	}
+	if len(stats.LargestKeys) == 0 || stats.LargestKeys[0].Key != "blob:1" || stats.LargestKeys[0].Size != 10000 {
+		t.Errorf("unexpected largest keys: %+v", stats.LargestKeys)
+	}
+
+	if len(stats.Models) != 1 {
+		t.Fatalf("unexpected models: %+v", stats.Models)
+	}
+	m := stats.Models[0]
+	if m.Name != "stats_user" || m.Total != 3 || m.Counter != 3 || m.IDLength != 4 {
+		t.Errorf("unexpected model stats: %+v", m)
+	}
+	if m.Indexes["name"] != 3 || m.Indexes["city"] != 2 {
+		t.Errorf("unexpected indexes: %v", m.Indexes)
+	}
+}
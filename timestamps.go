@@ -0,0 +1,89 @@
+package db
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// stampModel sets the fields with the tags `db:"created_at"` and `db:"updated_at"` by the clock of the database.
+// created_at is set when the model is new and the field is zero, otherwise it is kept from the stored model.
+// The fields are time.Time, *time.Time or integers of unix seconds.
+func (txn *Txn) stampModel(model, old any, isNew bool) error {
+	t := modelType(model)
+	if t == nil {
+		return nil
+	}
+	v := reflect.ValueOf(model)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if !v.CanSet() {
+		// a model passed by value is saved as is
+		return nil
+	}
+	var stored reflect.Value
+	if !isNew && old != nil {
+		stored = reflect.ValueOf(old).Elem()
+	}
+
+	now := txn.now()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get(tagName)
+		switch {
+		case tagHas(tag, "updated_at"):
+		case tagHas(tag, "created_at"):
+			if !v.Field(i).IsZero() {
+				continue
+			}
+			if stored.IsValid() {
+				v.Field(i).Set(stored.Field(i))
+				continue
+			}
+		default:
+			continue
+		}
+		if err := setTime(v.Field(i), now); err != nil {
+			return errors.Wrapf(err, "field: %s", field.Name)
+		}
+	}
+	return nil
+}
+
+func setTime(field reflect.Value, now time.Time) error {
+	switch {
+	case field.Type() == timeType:
+		field.Set(reflect.ValueOf(now))
+	case field.Kind() == reflect.Pointer && field.Type().Elem() == timeType:
+		field.Set(reflect.ValueOf(&now))
+	case field.CanInt():
+		field.SetInt(now.Unix())
+	case field.CanUint():
+		field.SetUint(uint64(now.Unix()))
+	default:
+		return errors.Errorf("unsupported timestamp type: %s", field.Type())
+	}
+	return nil
+}
+
+// getTime reads the time of the field set by setTime
+func getTime(field reflect.Value) (time.Time, bool) {
+	switch {
+	case field.Type() == timeType:
+		return field.Interface().(time.Time), true
+	case field.Kind() == reflect.Pointer && field.Type().Elem() == timeType:
+		if field.IsNil() {
+			return time.Time{}, false
+		}
+		return field.Elem().Interface().(time.Time), true
+	case field.CanInt():
+		return time.Unix(field.Int(), 0), true
+	case field.CanUint():
+		return time.Unix(int64(field.Uint()), 0), true
+	}
+	return time.Time{}, false
+}
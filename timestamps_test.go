@@ -0,0 +1,98 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type stampedPost struct {
+	Title     string
+	Status    string    `db:"default=draft"`
+	Views     int       `db:"default=10"`
+	Tags      []int     `db:"default=[1,2],was=Labels"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt int64     `db:"updated_at"`
+}
+
+func TestTimestamps(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	db, err := Open(filepath.Join(t.TempDir(), "db"), &Options{Clock: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	created := now
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSet(&stampedPost{Title: "a", Status: "published"}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+	err = db.Txn(func(txn *Txn) error {
+		// created_at is kept from the stored model
+		return txn.ModelSet(&stampedPost{Title: "b", Status: "published"}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		m, err := txn.ModelGet(&stampedPost{}, 1)
+		if err != nil {
+			return err
+		}
+		p := m.(*stampedPost)
+		if !p.CreatedAt.Equal(created) || p.UpdatedAt != now.Unix() {
+			t.Errorf("unexpected timestamps: %v, %d", p.CreatedAt, p.UpdatedAt)
+		}
+		if p.Status != "published" || p.Views != 0 {
+			t.Errorf("expected the stored fields to be kept: %+v", p)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		// an old document without the new fields
+		return txn.Set("stamped_post:1", `{"Title":"a"}`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		m, err := txn.ModelGet(&stampedPost{}, 1)
+		if err != nil {
+			return err
+		}
+		if p := m.(*stampedPost); p.Title != "a" || p.Status != "draft" || p.Views != 10 || len(p.Tags) != 2 || p.Tags[1] != 2 {
+			t.Errorf("unexpected defaults: %+v", p)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a default that can not be decoded is rejected before any read
+	type badDefault struct {
+		Views int `db:"default=ten"`
+	}
+	if err := Register[badDefault]("bad_default", nil); !errors.Is(err, ErrInvalidModel) {
+		t.Errorf("expected ErrInvalidModel but got %v", err)
+	}
+}
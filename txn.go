@@ -3,16 +3,57 @@ package db
 import (
 	"bytes"
 	"encoding/json"
+	"time"
 
 	"github.com/pkg/errors"
 	bolt "go.etcd.io/bbolt"
 )
 
 type Txn struct {
-	t *bolt.Tx
+	t  *bolt.Tx
+	db *DB
+
+	record  bool    // record the changes for the watchers
+	events  []Event // the changes of the transaction
+	logging bool    // append the changes to the change log
+	writes  int     // the number of written and deleted keys
+
+	includeDeleted bool            // the model functions return the soft deleted models
+	deleting       map[string]bool // the keys of the models being deleted, the cascades of a cycle stop at them
+}
+
+func (txn *Txn) now() time.Time {
+	if txn.db == nil {
+		return time.Now()
+	}
+	return txn.db.now()
 }
 
 func (txn *Txn) Set(key string, value any) error {
+	return txn.setVersion(key, value, 0)
+}
+
+// setVersion stores the value with the version, a new version is allocated when version is 0
+func (txn *Txn) setVersion(key string, value any, version uint64) error {
+	return txn.setEncoded(key, value, version, DefaultCodec)
+}
+
+func (txn *Txn) setEncoded(key string, value any, version uint64, codec Codec) error {
+	raw, err := codec.Encode(ToBytes(value))
+	if err != nil {
+		return err
+	}
+	if err := txn.put(key, raw); err != nil {
+		return err
+	}
+	if err := txn.Persist(key); err != nil {
+		return err
+	}
+	return txn.bumpVersion(key, version)
+}
+
+// put stores the value as is
+func (txn *Txn) put(key string, value []byte) error {
 	bucket := GetBucket(key)
 	b, err := txn.t.CreateBucketIfNotExists([]byte(bucket))
 	if err != nil {
@@ -20,55 +61,78 @@ func (txn *Txn) Set(key string, value any) error {
 	}
 	b.FillPercent = 1.0
 
-	raw := ToBytes(value)
-	if len(raw) > 0 {
-		compressed, err := GzipCompress(raw)
-		if err != nil || len(compressed) > len(raw) {
-			compressed = raw
+	if txn.record {
+		txn.events = append(txn.events, Event{Type: EventPut, Key: key, Old: decodeValue(b.Get([]byte(key))), New: decodeValue(value)})
+	}
+	if txn.logging {
+		if err := txn.appendLog(EventPut, key, value); err != nil {
+			return err
 		}
-		return b.Put([]byte(key), compressed)
 	}
-	return b.Put([]byte(key), raw)
+	txn.writes++
+	return b.Put([]byte(key), value)
 }
 
-func (txn *Txn) Get(key string) ([]byte, error) {
+// get returns the stored value, nil if the key does not exist or is expired.
+// The value is only valid in the transaction.
+func (txn *Txn) get(key string) []byte {
 	bucket := GetBucket(key)
 	b := txn.t.Bucket([]byte(bucket))
 	if b == nil {
-		return nil, ErrKeyNotFound
+		return nil
 	}
-
 	val := b.Get([]byte(key))
+	if val != nil && txn.expired(key) {
+		return nil
+	}
+	return val
+}
+
+func (txn *Txn) Get(key string) ([]byte, error) {
+	val := txn.get(key)
 	if val == nil {
 		return nil, ErrKeyNotFound
 	}
 
-	decode, err := GzipUncompress(val)
-	if err != nil {
-		decode = nil
-		decode = append(decode, val...)
-	}
-	return decode, nil
+	return decodeValue(val), nil
 }
 
 func (txn *Txn) Has(key string) bool {
-	bucket := GetBucket(key)
-	b := txn.t.Bucket([]byte(bucket))
-	if b == nil {
-		return false
-	}
-
-	item := b.Get([]byte(key))
-	return item != nil
+	return txn.get(key) != nil
 }
 
 func (txn *Txn) Del(key string) error {
-	bucket := GetBucket(key)
-	b, err := txn.t.CreateBucketIfNotExists([]byte(bucket))
-	if err != nil {
+	if err := txn.del(key); err != nil {
 		return err
 	}
+	if err := txn.Persist(key); err != nil {
+		return err
+	}
+	return txn.dropVersion(key)
+}
+
+func (txn *Txn) del(key string) error {
+	bucket := GetBucket(key)
+	b := txn.t.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
 
+	if txn.record || txn.logging {
+		old := b.Get([]byte(key))
+		if old == nil {
+			return nil
+		}
+		if txn.record {
+			txn.events = append(txn.events, Event{Type: EventDelete, Key: key, Old: decodeValue(old)})
+		}
+		if txn.logging {
+			if err := txn.appendLog(EventDelete, key, nil); err != nil {
+				return err
+			}
+		}
+	}
+	txn.writes++
 	return b.Delete([]byte(key))
 }
 
@@ -78,44 +142,40 @@ func (txn *Txn) Unmarshal(key string, value any) error {
 		return errors.Wrapf(err, "read item, key: %s", key)
 	}
 	err = json.Unmarshal(raw, value)
+	if err != nil {
+		// the counters written by Inc and Dec are binary, they are read as numbers
+		if c, ok := binaryCounter(raw); ok {
+			err = json.Unmarshal(c.json(), value)
+		}
+	}
 	if err != nil {
 		return errors.Wrapf(err, "unmarshal, key: %s, raw: %s", key, raw)
 	}
 	return nil
 }
 
-// return new value
+// return new value, the value is stored as a binary counter, see CounterAdd
 func (txn *Txn) Inc(key string, step int64) (int64, error) {
-	var val int64
-	err := txn.Unmarshal(key, &val)
-	if err != nil && !errors.Is(err, ErrKeyNotFound) {
-		return 0, err
-	}
-	val += step
-	return val, txn.Set(key, val)
+	return txn.CounterAdd(key, step)
 }
 
 // return new value
 func (txn *Txn) Dec(key string, step int64) (int64, error) {
-	var val int64
-	err := txn.Unmarshal(key, &val)
-	if err != nil && !errors.Is(err, ErrKeyNotFound) {
-		return 0, err
-	}
-	val -= step
-	return val, txn.Set(key, val)
+	return txn.CounterAdd(key, -step)
 }
 
 func (txn *Txn) List(prefix string, fn func(key string, value []byte) (stop bool, err error), options ...*ListOption) error {
 	beginKey := ""
 	containBegin := false
 	reverse := false
+	endKey := ""
 	limit := 0
 	keyOnly := false
 	if len(options) > 0 {
 		opt := options[0]
 		beginKey = opt.Begin
 		containBegin = opt.ContainBegin
+		endKey = opt.End
 		reverse = opt.Reverse
 		limit = opt.Limit
 		keyOnly = opt.KeyOnly
@@ -136,29 +196,57 @@ func (txn *Txn) List(prefix string, fn func(key string, value []byte) (stop bool
 	}
 
 	bytePrefix := []byte(prefix)
+	byteEnd := []byte(endKey)
+	// whether the key is beyond the end key
+	beyond := func(key []byte) bool {
+		if endKey == "" {
+			return false
+		}
+		if reverse {
+			return bytes.Compare(key, byteEnd) <= 0
+		}
+		return bytes.Compare(key, byteEnd) >= 0
+	}
 
 	var k []byte
 	var v []byte
 	if beginKey != "" {
-		k, v = c.Seek([]byte(beginKey))
-		// skip to next
-		if k != nil && !containBegin {
+		byteBegin := []byte(beginKey)
+		k, v = c.Seek(byteBegin)
+		if reverse && k == nil {
+			k, v = c.Last()
+		} else if reverse && !bytes.Equal(k, byteBegin) {
+			// the begin key does not exist, the cursor is on the key after it
+			k, v = c.Prev()
+		} else if bytes.Equal(k, byteBegin) && !containBegin {
+			// skip to next
 			k, v = it()
 		}
+	} else if reverse {
+		// start from the last key of the prefix
+		if succ := prefixSuccessor(bytePrefix); succ != nil {
+			k, v = c.Seek(succ)
+		}
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
 	} else {
 		k, v = c.Seek(bytePrefix)
 	}
 
-	for i := 0; bytes.HasPrefix(k, bytePrefix); k, v = it() {
+	// expired keys are skipped
+	checkExpiry := !isInternal(prefix) && txn.t.Bucket([]byte("_exp")) != nil
+
+	for i := 0; bytes.HasPrefix(k, bytePrefix) && !beyond(k); k, v = it() {
+		if checkExpiry && txn.expired(string(k)) {
+			continue
+		}
+
 		var val []byte
 		if !keyOnly {
-			decode, err := GzipUncompress(v)
-			if err != nil {
-				decode = nil
-				val = append(val, v...)
-			} else {
-				val = decode
-			}
+			val = decodeValue(v)
 		}
 		if b, err := fn(string(k), val); err != nil || b {
 			return err
@@ -171,3 +259,43 @@ func (txn *Txn) List(prefix string, fn func(key string, value []byte) (stop bool
 	}
 	return nil
 }
+
+func (txn *Txn) SetKey(key Key, value any) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	return txn.Set(key.String(), value)
+}
+
+func (txn *Txn) GetKey(key Key) ([]byte, error) {
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	return txn.Get(key.String())
+}
+
+func (txn *Txn) HasKey(key Key) bool {
+	return key.Validate() == nil && txn.Has(key.String())
+}
+
+func (txn *Txn) DelKey(key Key) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	return txn.Del(key.String())
+}
+
+func (txn *Txn) UnmarshalKey(key Key, value any) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	return txn.Unmarshal(key.String(), value)
+}
+
+// ListKey iterates over the keys extending the key, the key passed to fn can be decoded by ParseKey
+func (txn *Txn) ListKey(key Key, fn func(key string, value []byte) (stop bool, err error), options ...*ListOption) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	return txn.List(key.Prefix(), fn, options...)
+}
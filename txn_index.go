@@ -8,27 +8,54 @@ import (
 
 const tagName = "db"
 
+// indexKey returns the key of the index entry in lower case, the entry stores the id as is
+func indexKey(baseKey string, id any) string {
+	return strings.ToLower(fmt.Sprintf("_i:%s:%v", baseKey, id))
+}
+
+// indexID returns the id of the index entry, the entries written before the ids were stored have empty values
+func indexID(key, prefix string, value []byte) string {
+	if len(value) > 0 {
+		return string(value)
+	}
+	return strings.TrimPrefix(key, prefix)
+}
+
 func (txn *Txn) IndexAdd(model any, field string, val, id any) error {
-	baseKey := GenerateIndexBaseKey(model, field, val)
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return err
+	}
+	return txn.indexAdd(modelName, field, val, id)
+}
 
-	key := strings.ToLower(fmt.Sprintf("_i:%s:%v", baseKey, id))
+func (txn *Txn) indexAdd(modelName string, field string, val, id any) error {
+	baseKey := indexBaseKey(modelName, field, val)
+	key := indexKey(baseKey, id)
 	if txn.Has(key) {
 		return nil
 	}
 
-	if err := txn.Set(key, ""); err != nil {
+	if err := txn.Set(key, fmt.Sprintf("%v", id)); err != nil {
 		return err
 	}
 
 	// inc count
-	_, err := txn.Inc(fmt.Sprintf("_ic:%s", baseKey), 1)
+	_, err := txn.CounterAdd(fmt.Sprintf("_ic:%s", baseKey), 1)
 	return err
 }
 
 func (txn *Txn) IndexDel(model any, field string, val, id any) error {
-	baseKey := GenerateIndexBaseKey(model, field, val)
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return err
+	}
+	return txn.indexDel(modelName, field, val, id)
+}
 
-	key := fmt.Sprintf("_i:%s:%v", baseKey, id)
+func (txn *Txn) indexDel(modelName string, field string, val, id any) error {
+	baseKey := indexBaseKey(modelName, field, val)
+	key := indexKey(baseKey, id)
 	if !txn.Has(key) {
 		return nil
 	}
@@ -38,12 +65,16 @@ func (txn *Txn) IndexDel(model any, field string, val, id any) error {
 	}
 
 	// dec count
-	_, err := txn.Dec(fmt.Sprintf("_ic:%s", baseKey), 1)
+	_, err := txn.CounterAdd(fmt.Sprintf("_ic:%s", baseKey), -1)
 	return err
 }
 
 func (txn *Txn) IndexList(model any, field string, val any, opts ...*ListOption) (list []string, err error) {
-	baseKey := GenerateIndexBaseKey(model, field, val)
+	modelName, err := modelNameOf(model)
+	if err != nil {
+		return nil, err
+	}
+	baseKey := indexBaseKey(modelName, field, val)
 	prefix := fmt.Sprintf("_i:%s:", baseKey)
 
 	var opt *ListOption
@@ -52,40 +83,76 @@ func (txn *Txn) IndexList(model any, field string, val any, opts ...*ListOption)
 	} else {
 		opt = &ListOption{}
 	}
-	opt.KeyOnly = true
+
+	// the soft deleted models are skipped, so the limit is counted here
+	hidden := !opt.IncludeDeleted && !txn.includeDeleted && txn.hasDeleted()
+	listOpt := *opt
+	listOpt.Limit = 0
+	listOpt.KeyOnly = false
 
 	err = txn.List(prefix,
 		func(key string, value []byte) (bool, error) {
-			list = append(list, strings.TrimPrefix(key, prefix))
-			return false, nil
+			id := indexID(key, prefix, value)
+			if hidden && txn.Has(deletedKey(modelName, id)) {
+				return false, nil
+			}
+			list = append(list, id)
+			return opt.Limit > 0 && len(list) >= opt.Limit, nil
 		},
-		opt,
+		&listOpt,
 	)
 	return
 }
 
+// IndexCount returns the number of models in the index, the soft deleted models are not counted like IndexList,
+// unless the transaction includes them. The entries are counted one by one when the model has soft deleted models.
 func (txn *Txn) IndexCount(model any, field string, val any) (total int64) {
-	baseKey := GenerateIndexBaseKey(model, field, val)
-	txn.Unmarshal(fmt.Sprintf("_ic:%s", baseKey), &total)
+	modelName := modelNameOrEmpty(model)
+	if modelName == "" {
+		return 0
+	}
+	baseKey := indexBaseKey(modelName, field, val)
+	if txn.includeDeleted || !txn.modelHasDeleted(modelName) {
+		total, _ = txn.CounterGet(fmt.Sprintf("_ic:%s", baseKey))
+		return
+	}
+
+	prefix := fmt.Sprintf("_i:%s:", baseKey)
+	txn.List(prefix, func(key string, value []byte) (bool, error) {
+		if !txn.Has(deletedKey(modelName, indexID(key, prefix, value))) {
+			total++
+		}
+		return false, nil
+	})
 	return
 }
 
 func (txn *Txn) IndexClear(model any, field string, val any) error {
-	baseKey := GenerateIndexBaseKey(model, field, val)
+	baseKey, err := modelIndexBaseKey(model, field, val)
+	if err != nil {
+		return err
+	}
 
-	// delete list
+	// delete list, the keys are collected first because deleting moves the cursor
 	prefix := fmt.Sprintf("_i:%s:", baseKey)
 	opt := &ListOption{}
 	opt.KeyOnly = true
-	err := txn.List(prefix,
+	var keys []string
+	err = txn.List(prefix,
 		func(key string, value []byte) (bool, error) {
-			return false, txn.Del(key)
+			keys = append(keys, key)
+			return false, nil
 		},
 		opt,
 	)
 	if err != nil {
 		return err
 	}
+	for _, key := range keys {
+		if err := txn.Del(key); err != nil {
+			return err
+		}
+	}
 
 	// delete count
 	return txn.Del(fmt.Sprintf("_ic:%s", baseKey))
@@ -93,6 +160,52 @@ func (txn *Txn) IndexClear(model any, field string, val any) error {
 
 // When isCreate is true, it means to create an index, otherwise it means to delete the index
 func (txn *Txn) IndexModel(id, model any, isCreate bool) error {
+	var action func(modelName string, field string, val, id any) error
+	if isCreate {
+		action = txn.indexAdd
+	} else {
+		action = txn.indexDel
+	}
+	return eachIndex(model, func(modelName, indexName string, val any) error {
+		// log.Printf("model: %s, index: %s, value: %v, id: %v", modelName, indexName, val, id)
+		return action(modelName, indexName, val, id)
+	})
+}
+
+// fieldIndexName returns the index name of the field, and whether the field is indexed
+func fieldIndexName(fieldType reflect.StructField) (string, bool) {
+	// Get the field tag value
+	tag := fieldType.Tag.Get(tagName)
+	if tag == "" || !strings.Contains(tag, "index") {
+		return "", false
+	}
+
+	// defautl index name is feild name
+	indexName := fieldType.Name
+
+	// if specified manually, use the specified name
+	multTypes := strings.Split(strings.Trim(tag, ", ;"), ",")
+	for _, v := range multTypes {
+		if strings.HasPrefix(v, "index") {
+			indexs := strings.Split(v, "=")
+			if len(indexs) == 2 {
+				indexName = strings.TrimSpace(indexs[1])
+			}
+		}
+	}
+	return indexName, true
+}
+
+// modelFieldIndex returns the index name of the field by its tag or the registry
+func modelFieldIndex(modelType reflect.Type, i int) (string, bool) {
+	if name, ok := fieldIndexName(modelType.Field(i)); ok {
+		return name, true
+	}
+	return registeredIndex(modelType, modelType.Field(i).Name)
+}
+
+// eachIndex calls fn with every indexed value of the model
+func eachIndex(model any, fn func(modelName, indexName string, val any) error) error {
 	modelValue := reflect.ValueOf(model)
 	k := modelValue.Kind()
 	for k == reflect.Pointer || k == reflect.UnsafePointer {
@@ -108,39 +221,18 @@ func (txn *Txn) IndexModel(id, model any, isCreate bool) error {
 
 	modelType := modelValue.Type()
 
-	modelName := modelType.Name()
-
-	var action func(model any, field string, val, id any) error
-	if isCreate {
-		action = txn.IndexAdd
-	} else {
-		action = txn.IndexDel
+	modelName, err := modelNameOf(model)
+	if err != nil {
+		return err
 	}
 
 	// Iterate over all available fields and read the tag value
 	for i := 0; i < modelType.NumField(); i++ {
-		fieldType := modelType.Field(i)
-
-		// Get the field tag value
-		tag := fieldType.Tag.Get(tagName)
-		if tag == "" || !strings.Contains(tag, "index") {
+		indexName, ok := modelFieldIndex(modelType, i)
+		if !ok {
 			continue
 		}
 
-		// defautl index name is feild name
-		indexName := fieldType.Name
-
-		// if specified manually, use the specified name
-		multTypes := strings.Split(strings.Trim(tag, ", ;"), ",")
-		for _, v := range multTypes {
-			if strings.HasPrefix(v, "index") {
-				indexs := strings.Split(v, "=")
-				if len(indexs) == 2 {
-					indexName = strings.TrimSpace(indexs[1])
-				}
-			}
-		}
-
 		fieldValue := modelValue.Field(i)
 
 		kind := fieldValue.Kind()
@@ -154,8 +246,7 @@ func (txn *Txn) IndexModel(id, model any, isCreate bool) error {
 				if !ok {
 					continue
 				}
-				// log.Printf("model: %s, index: %s, value: %v, id: %v", modelName, indexName, val, id)
-				if err := action(modelName, indexName, val, id); err != nil {
+				if err := fn(modelName, indexName, val); err != nil {
 					return err
 				}
 			}
@@ -170,8 +261,7 @@ func (txn *Txn) IndexModel(id, model any, isCreate bool) error {
 				if !ok {
 					continue
 				}
-				// log.Printf("model: %s, index: %s, value: %v, id: %v", modelName, indexName, val, id)
-				if err := action(modelName, indexName, val, id); err != nil {
+				if err := fn(modelName, indexName, val); err != nil {
 					return err
 				}
 			}
@@ -181,8 +271,7 @@ func (txn *Txn) IndexModel(id, model any, isCreate bool) error {
 			if !ok {
 				continue
 			}
-			// log.Printf("model: %s, index: %s, value: %v, id: %v", modelName, indexName, val, id)
-			if err := action(modelName, indexName, val, id); err != nil {
+			if err := fn(modelName, indexName, val); err != nil {
 				return err
 			}
 		}
@@ -4,55 +4,104 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
+const sortableIDFormat = "sortable"
+
 func (txn *Txn) ModelNextID(model any, length int) string {
-	modelName := ToModelName(model)
+	modelName := modelNameOrEmpty(model)
 	if modelName == "" {
 		return ""
 	}
+	return txn.modelNextID(modelName, length)
+}
 
-	c, _ := txn.Inc(fmt.Sprintf("_counter:%s", modelName), 1)
+func (txn *Txn) modelNextID(modelName string, length int) string {
+	c, _ := txn.CounterAdd(fmt.Sprintf("_counter:%s", modelName), 1)
+	if txn.hasSortableID(modelName) {
+		return SortableID(c)
+	}
 
-	txn.Set(fmt.Sprintf("_id_len:%s", modelName), length)
+	if txn.modelIDLength(modelName) != length {
+		txn.Set(fmt.Sprintf("_id_len:%s", modelName), length)
+	}
 
 	return PaddingZero(c, length)
 }
 
 func (txn *Txn) ModelCounter(model any) (count int64) {
-	modelName := ToModelName(model)
+	modelName := modelNameOrEmpty(model)
 	if modelName == "" {
 		return 0
 	}
+	return txn.modelCounter(modelName)
+}
 
-	txn.Unmarshal(fmt.Sprintf("_counter:%s", modelName), &count)
+func (txn *Txn) modelCounter(modelName string) (count int64) {
+	count, _ = txn.CounterGet(fmt.Sprintf("_counter:%s", modelName))
 	return
 }
 
+// ModelTotal returns the number of the stored models, the soft deleted models are counted until they are purged
 func (txn *Txn) ModelTotal(model any) (count int64) {
-	modelName := ToModelName(model)
+	modelName := modelNameOrEmpty(model)
 	if modelName == "" {
 		return 0
 	}
+	return txn.modelTotal(modelName)
+}
 
-	txn.Unmarshal(fmt.Sprintf("_total:%s", modelName), &count)
+func (txn *Txn) modelTotal(modelName string) (count int64) {
+	count, _ = txn.CounterGet(fmt.Sprintf("_total:%s", modelName))
 	return
 }
 
 func (txn *Txn) ModelIdLength(model any) (length int) {
-	modelName := ToModelName(model)
+	modelName := modelNameOrEmpty(model)
 	if modelName == "" {
 		return 0
 	}
+	return txn.modelIDLength(modelName)
+}
 
+func (txn *Txn) modelIDLength(modelName string) (length int) {
 	txn.Unmarshal(fmt.Sprintf("_id_len:%s", modelName), &length)
 	return
 }
 
+func (txn *Txn) hasSortableID(modelName string) bool {
+	raw, err := txn.Get(fmt.Sprintf("_id_fmt:%s", modelName))
+	return err == nil && string(raw) == sortableIDFormat
+}
+
+// modelKey returns the key of the model, the numeric id of a model using sortable ids is converted to a sortable id
+func (txn *Txn) modelKey(modelName string, id any) (string, any) {
+	if txn.hasSortableID(modelName) {
+		text := fmt.Sprintf("%v", id)
+		if _, err := ParseSortableID(text); err != nil {
+			if n, err := strconv.ParseInt(text, 10, 64); err == nil && n >= 0 {
+				id = SortableID(n)
+			}
+		}
+	}
+	return fmt.Sprintf("%s:%v", modelName, id), id
+}
+
+// ModelNewID generates an id by the generator of the model
+func (txn *Txn) ModelNewID(model any) (string, error) {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return "", err
+	}
+	return GetIDGenerator(model).NextID(txn, modelName)
+}
+
 func (txn *Txn) ModelSet(model, id any) error {
-	modelName := ToModelName(model)
-	if modelName == "" {
-		return nil
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return err
 	}
 
 	// update index
@@ -60,16 +109,32 @@ func (txn *Txn) ModelSet(model, id any) error {
 	if old == nil {
 		return nil
 	}
+	if err := checkLoadFields(modelType(model)); err != nil {
+		return err
+	}
+	key, id := txn.modelKey(modelName, id)
+	err = txn.unmarshalModel(key, old)
+	isNew := err != nil
+	if isNew && !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+	if err := txn.stampModel(model, old, isNew); err != nil {
+		return err
+	}
+	if err := txn.runHooks(HookBeforeSave, modelName, model); err != nil {
+		return err
+	}
+	stored := old
+	if isNew {
+		stored = nil
+	}
+	if err := txn.syncRefs(modelName, id, stored, model); err != nil {
+		return err
+	}
 
-	key := fmt.Sprintf("%s:%v", modelName, id)
-	err := txn.Unmarshal(key, old)
-	if err != nil {
-		if !errors.Is(err, ErrKeyNotFound) {
-			return err
-		}
-
+	if isNew {
 		// inc total
-		if _, err := txn.Inc(fmt.Sprintf("_total:%s", modelName), 1); err != nil {
+		if _, err := txn.CounterAdd(fmt.Sprintf("_total:%s", modelName), 1); err != nil {
 			return err
 		}
 	} else {
@@ -82,13 +147,28 @@ func (txn *Txn) ModelSet(model, id any) error {
 	}
 
 	// save model
-	return txn.Set(key, model)
+	if err := txn.saveModel(key, model); err != nil {
+		return err
+	}
+	if err := txn.syncDeleted(modelName, id, model); err != nil {
+		return err
+	}
+	if err := txn.recordHistory(modelName, id, model, false); err != nil {
+		return err
+	}
+	if txn.record {
+		if isNew {
+			old = nil
+		}
+		txn.annotateModel(key, modelName, old, model)
+	}
+	return txn.runHooks(HookAfterSave, modelName, model)
 }
 
 func (txn *Txn) ModelDel(model, id any) error {
-	modelName := ToModelName(model)
-	if modelName == "" {
-		return nil
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return err
 	}
 
 	m := NewModel(model)
@@ -96,27 +176,84 @@ func (txn *Txn) ModelDel(model, id any) error {
 		return nil
 	}
 
-	key := fmt.Sprintf("%s:%v", modelName, id)
+	key, id := txn.modelKey(modelName, id)
 
 	// delete index
-	err := txn.Unmarshal(key, m)
+	err = txn.unmarshalModel(key, m)
 	if err != nil {
 		if !errors.Is(err, ErrKeyNotFound) {
 			return err
 		}
 		return nil
 	}
-	if err = txn.IndexModel(id, m, false); err != nil {
+	if txn.deleting[key] {
+		return nil
+	}
+	if txn.deleting == nil {
+		txn.deleting = map[string]bool{}
+	}
+	txn.deleting[key] = true
+	defer delete(txn.deleting, key)
+
+	// the referencing models of a soft deleted model are kept until it is purged
+	field, soft := softDeleteField(m)
+	if err := txn.applyRefPolicies(modelName, id, soft); err != nil {
+		return err
+	}
+	if soft {
+		return txn.softDelete(modelName, key, id, m, field)
+	}
+	if err := txn.runHooks(HookBeforeDelete, modelName, m); err != nil {
+		return err
+	}
+	if err := txn.removeModel(modelName, key, id, m); err != nil {
+		return err
+	}
+	return txn.runHooks(HookAfterDelete, modelName, m)
+}
+
+// removeModel deletes the loaded model and its index data
+func (txn *Txn) removeModel(modelName, key string, id, m any) error {
+	if err := txn.IndexModel(id, m, false); err != nil {
 		return err
 	}
 
 	// dec total
-	if _, err := txn.Dec(fmt.Sprintf("_total:%s", modelName), 1); err != nil {
+	if _, err := txn.CounterAdd(fmt.Sprintf("_total:%s", modelName), -1); err != nil {
 		return err
 	}
 
 	// del model
-	return txn.Del(key)
+	if err := txn.Del(key); err != nil {
+		return err
+	}
+	if err := txn.syncRefs(modelName, id, m, nil); err != nil {
+		return err
+	}
+	if txn.isDeleted(modelName, id) {
+		if err := txn.Del(deletedKey(modelName, id)); err != nil {
+			return err
+		}
+	}
+	if err := txn.recordHistory(modelName, id, m, true); err != nil {
+		return err
+	}
+	if txn.record {
+		txn.annotateModel(key, modelName, m, nil)
+	}
+	return nil
+}
+
+// loadModel reads the model, the soft deleted models are not found unless includeDeleted is true
+func (txn *Txn) loadModel(modelName string, id, m any, includeDeleted bool) error {
+	key, id := txn.modelKey(modelName, id)
+	if !includeDeleted && txn.isDeleted(modelName, id) {
+		return fmt.Errorf("read item, key: %s, the model is deleted: %w", key, ErrKeyNotFound)
+	}
+	if err := txn.unmarshalModel(key, m); err != nil {
+		return err
+	}
+	return txn.afterLoad(key, modelName, m)
 }
 
 func (txn *Txn) ModelUpdate(model, id any, cb func(mPointer any) error) error {
@@ -125,14 +262,15 @@ func (txn *Txn) ModelUpdate(model, id any, cb func(mPointer any) error) error {
 		return ErrKeyNotFound
 	}
 
-	modelName := ToModelName(m)
+	modelName, err := modelNameOf(m)
+	if err != nil {
+		return err
+	}
 	if modelName == "" {
 		return ErrKeyNotFound
 	}
 
-	key := fmt.Sprintf("%s:%v", modelName, id)
-	err := txn.Unmarshal(key, m)
-	if err != nil {
+	if err := txn.loadModel(modelName, id, m, txn.includeDeleted); err != nil {
 		return err
 	}
 
@@ -149,55 +287,68 @@ func (txn *Txn) ModelGet(model, id any) (any, error) {
 		return nil, ErrKeyNotFound
 	}
 
-	modelName := ToModelName(m)
+	modelName, err := modelNameOf(m)
+	if err != nil {
+		return nil, err
+	}
 	if modelName == "" {
 		return nil, ErrKeyNotFound
 	}
 
-	key := fmt.Sprintf("%s:%v", modelName, id)
-	err := txn.Unmarshal(key, m)
-	return m, err
+	return m, txn.loadModel(modelName, id, m, txn.includeDeleted)
 }
 
 func (txn *Txn) ModelUnmarshal(model, id any) error {
-	modelName := ToModelName(model)
+	modelName, err := modelNameOf(model)
+	if err != nil {
+		return err
+	}
 	if modelName == "" {
 		return ErrKeyNotFound
 	}
 
-	key := fmt.Sprintf("%s:%v", modelName, id)
-	return txn.Unmarshal(key, model)
+	return txn.loadModel(modelName, id, model, txn.includeDeleted)
 }
 
-func (txn *Txn) ModelList(model any, limit int, begin string, reverse bool) (list []any, err error) {
-	modelName := ToModelName(model)
-	if modelName == "" {
-		return nil, nil
+// ModelList lists the models, only IncludeDeleted and Include of the options are used
+func (txn *Txn) ModelList(model any, limit int, begin string, reverse bool, opts ...*ListOption) (list []any, err error) {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return nil, err
 	}
 
 	prefix := fmt.Sprintf("%s:", modelName)
 
-	containBegin := false
-	if begin == "" && reverse {
-		last := txn.ModelCounter(model)
-		begin = fmt.Sprintf("%s%s", prefix, PaddingZero(last, txn.ModelIdLength(model)))
-		containBegin = true
-	}
 	opt := &ListOption{
-		Begin:        begin,
-		ContainBegin: containBegin,
-		Limit:        limit,
-		Reverse:      reverse,
+		Begin:   begin,
+		Reverse: reverse,
+	}
+	includeDeleted := txn.includeDeleted
+	var include []string
+	if len(opts) > 0 {
+		includeDeleted = includeDeleted || opts[0].IncludeDeleted
+		include = opts[0].Include
 	}
+	hidden := !includeDeleted && txn.hasDeleted()
 	err = txn.List(prefix, func(key string, value []byte) (bool, error) {
+		// the soft deleted models are skipped, so the limit is counted here
+		if hidden && txn.Has("_deleted:"+key) {
+			return false, nil
+		}
 		m := NewModel(model)
-		if err := json.Unmarshal(value, m); err != nil {
+		if _, err := decodeModel(value, m); err != nil {
+			return true, err
+		}
+		if err := txn.afterLoad(key, modelName, m); err != nil {
 			return true, err
 		}
 		list = append(list, m)
-		return false, nil
+		return limit > 0 && len(list) >= limit, nil
 	}, opt)
-	return
+	if err != nil {
+		return nil, err
+	}
+	return list, txn.include(list, include, includeDeleted)
 }
 
 func (txn *Txn) ModelIndexList(model any, feild string, val any, opts ...*ListOption) (list []any, err error) {
@@ -205,12 +356,117 @@ func (txn *Txn) ModelIndexList(model any, feild string, val any, opts ...*ListOp
 	if err != nil {
 		return nil, err
 	}
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" || NewModel(model) == nil {
+		return nil, err
+	}
+	includeDeleted := txn.includeDeleted
+	var include []string
+	if len(opts) > 0 {
+		includeDeleted = includeDeleted || opts[0].IncludeDeleted
+		include = opts[0].Include
+	}
 	for _, v := range ids {
-		o, err := txn.ModelGet(model, v)
-		if err != nil {
+		o := NewModel(model)
+		if err := txn.loadModel(modelName, v, o, includeDeleted); err != nil {
 			return nil, err
 		}
 		list = append(list, o)
 	}
-	return
+	return list, txn.include(list, include, includeDeleted)
+}
+
+// ModelMigrateSortableID re-keys the models with numeric ids to sortable ids in chunks of batchSize,
+// after that ModelNextID always returns sortable ids. Ids that are not numeric are kept.
+// It fails before any change when two ids have the same number, such as "7" and "007".
+// The model should not be written during the migration.
+func (t *DB) ModelMigrateSortableID(model any, batchSize int) error {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" || NewModel(model) == nil {
+		return err
+	}
+	prefix := fmt.Sprintf("%s:", modelName)
+
+	// the ids with the same number would overwrite each other
+	err = t.Txn(func(txn *Txn) error {
+		numbers := map[int64]string{}
+		return txn.List(prefix, func(key string, value []byte) (bool, error) {
+			id := strings.TrimPrefix(key, prefix)
+			n, err := ParseSortableID(id)
+			if err != nil {
+				if n, err = strconv.ParseInt(id, 10, 64); err != nil || n < 0 {
+					return false, nil
+				}
+			}
+			if other, ok := numbers[n]; ok {
+				return true, fmt.Errorf("model: %s, the ids %s and %s are both %s: %w", modelName, other, id, SortableID(n), ErrInvalidID)
+			}
+			numbers[n] = id
+			return false, nil
+		}, &ListOption{KeyOnly: true})
+	}, true)
+	if err != nil {
+		return err
+	}
+
+	err = t.chunks(prefix, "", batchSize, func(txn *Txn, keys []string) error {
+		for _, key := range keys {
+			id := strings.TrimPrefix(key, prefix)
+			if _, err := ParseSortableID(id); err == nil {
+				continue
+			}
+			n, err := strconv.ParseInt(id, 10, 64)
+			if err != nil || n < 0 {
+				continue
+			}
+			if err := txn.moveModelID(modelName, model, id, SortableID(n)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	return t.Txn(func(txn *Txn) error {
+		return txn.Set(fmt.Sprintf("_id_fmt:%s", modelName), sortableIDFormat)
+	})
+}
+
+// moveModelID moves the model, its index data, deletion mark, references and history to the new id
+func (txn *Txn) moveModelID(modelName string, model any, id, newID string) error {
+	m := NewModel(model)
+	oldKey := fmt.Sprintf("%s:%s", modelName, id)
+	newKey := fmt.Sprintf("%s:%s", modelName, newID)
+	if txn.Has(newKey) {
+		return fmt.Errorf("model: %s, the id %s is moved to an existing id %s: %w", modelName, id, newID, ErrInvalidID)
+	}
+	raw, err := txn.Get(oldKey)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return err
+	}
+
+	if err := txn.IndexModel(id, m, false); err != nil {
+		return err
+	}
+	if err := txn.IndexModel(newID, m, true); err != nil {
+		return err
+	}
+	if err := txn.Del(oldKey); err != nil {
+		return err
+	}
+	if err := txn.Set(newKey, raw); err != nil {
+		return err
+	}
+	if err := moveKey(txn, deletedKey(modelName, id), deletedKey(modelName, newID)); err != nil {
+		return err
+	}
+	if err := txn.moveRefs(modelName, m, id, newID); err != nil {
+		return err
+	}
+	return txn.moveHistory(modelName, id, newID)
 }
@@ -0,0 +1,161 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"time"
+)
+
+// The deadline of a key is stored in "_exp:key", and the key is indexed by deadline
+// in "_ttl:<8 bytes big-endian unix nano><key>", so the sweeper purges the keys in time order.
+
+func expiryKey(key string) string {
+	return "_exp:" + key
+}
+
+func expiryIndexKey(key string, deadline int64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(deadline))
+	return "_ttl:" + string(buf[:]) + key
+}
+
+// deadline returns the unix nano deadline of the key, 0 if the key never expires
+func (txn *Txn) deadline(key string) int64 {
+	if isInternal(key) {
+		return 0
+	}
+	raw := txn.get(expiryKey(key))
+	if raw == nil {
+		return 0
+	}
+	c, err := decodeCounter(raw)
+	if err != nil {
+		return 0
+	}
+	return c.Int()
+}
+
+func (txn *Txn) expired(key string) bool {
+	deadline := txn.deadline(key)
+	return deadline > 0 && deadline <= txn.now().UnixNano()
+}
+
+// SetWithTTL sets the value, the key is treated as missing after ttl
+func (txn *Txn) SetWithTTL(key string, value any, ttl time.Duration) error {
+	if err := txn.Set(key, value); err != nil {
+		return err
+	}
+	return txn.ExpireAt(key, txn.now().Add(ttl))
+}
+
+// ExpireAt sets the deadline of an existing key, keys in the internal buckets never expire
+func (txn *Txn) ExpireAt(key string, deadline time.Time) error {
+	if !txn.Has(key) {
+		return ErrKeyNotFound
+	}
+	if isInternal(key) {
+		return nil
+	}
+	if err := txn.Persist(key); err != nil {
+		return err
+	}
+
+	at := deadline.UnixNano()
+	if err := txn.put(expiryIndexKey(key, at), []byte{}); err != nil {
+		return err
+	}
+	return txn.CounterSet(expiryKey(key), at)
+}
+
+// Persist removes the deadline of the key
+func (txn *Txn) Persist(key string) error {
+	deadline := txn.deadline(key)
+	if deadline == 0 {
+		return nil
+	}
+	if err := txn.del(expiryIndexKey(key, deadline)); err != nil {
+		return err
+	}
+	return txn.del(expiryKey(key))
+}
+
+// TTL returns the remaining time to live of the key, 0 if the key never expires
+func (txn *Txn) TTL(key string) (time.Duration, error) {
+	if !txn.Has(key) {
+		return 0, ErrKeyNotFound
+	}
+	deadline := txn.deadline(key)
+	if deadline == 0 {
+		return 0, nil
+	}
+	return time.Duration(deadline - txn.now().UnixNano()), nil
+}
+
+// PurgeExpired deletes at most limit expired keys, and returns the number of deleted keys
+func (txn *Txn) PurgeExpired(limit int) (int, error) {
+	b := txn.t.Bucket([]byte("_ttl"))
+	if b == nil {
+		return 0, nil
+	}
+
+	now := txn.now().UnixNano()
+	prefix := []byte("_ttl:")
+	var keys []string
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix) && len(keys) < limit; k, _ = c.Next() {
+		raw := k[len(prefix):]
+		if len(raw) < 8 || int64(binary.BigEndian.Uint64(raw[:8])) > now {
+			break
+		}
+		keys = append(keys, string(raw[8:]))
+	}
+
+	for _, key := range keys {
+		if err := txn.Del(key); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// PurgeExpired deletes the expired keys in writes of at most SweepBatch keys
+func (t *DB) PurgeExpired() (total int, err error) {
+	for {
+		var n int
+		err = t.Txn(func(txn *Txn) (err error) {
+			n, err = txn.PurgeExpired(t.opts.SweepBatch)
+			return
+		})
+		total += n
+		if err != nil || n < t.opts.SweepBatch {
+			return
+		}
+
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+	}
+}
+
+func (t *DB) sweep(interval time.Duration) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			if _, err := t.PurgeExpired(); err != nil {
+				log.Printf("purge expired keys: %v", err)
+			}
+			if _, err := t.applyLogRetention(); err != nil {
+				log.Printf("truncate change log: %v", err)
+			}
+		}
+	}
+}
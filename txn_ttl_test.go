@@ -0,0 +1,140 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestTTL(t *testing.T) {
+	clock := &testClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	db, err := Open(filepath.Join(t.TempDir(), "db"), &Options{Clock: clock.Now, SweepBatch: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		for _, key := range []string{"session:a", "session:b", "session:c"} {
+			if err := txn.SetWithTTL(key, "token", time.Minute); err != nil {
+				return err
+			}
+		}
+		if err := txn.SetWithTTL("session:d", "token", time.Hour); err != nil {
+			return err
+		}
+		if err := txn.Set("session:e", "token"); err != nil {
+			return err
+		}
+
+		// set clears the ttl
+		if err := txn.SetWithTTL("session:f", "token", time.Minute); err != nil {
+			return err
+		}
+		return txn.Set("session:f", "token")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() (n int) {
+		db.List("session:", func(key string, value []byte) (bool, error) {
+			n++
+			return false, nil
+		})
+		return
+	}
+	if n := count(); n != 6 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	clock.Add(2 * time.Minute)
+	if n := count(); n != 3 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+	db.Txn(func(txn *Txn) error {
+		if _, err := txn.Get("session:a"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("expected not found, got %v", err)
+		}
+		if txn.Has("session:b") {
+			t.Error("expired key exists")
+		}
+		if ttl, _ := txn.TTL("session:d"); ttl != 58*time.Minute {
+			t.Errorf("unexpected ttl: %v", ttl)
+		}
+		return nil
+	}, true)
+
+	n, err := db.PurgeExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("unexpected purged: %d", n)
+	}
+
+	// the expired keys are really deleted
+	db.Txn(func(txn *Txn) error {
+		if b := txn.t.Bucket([]byte("session")); b.Stats().KeyN != 3 {
+			t.Errorf("unexpected keys: %d", b.Stats().KeyN)
+		}
+		if b := txn.t.Bucket([]byte("_ttl")); b.Stats().KeyN != 1 {
+			t.Errorf("unexpected ttl index: %d", b.Stats().KeyN)
+		}
+		return nil
+	}, true)
+}
+
+func TestSweeper(t *testing.T) {
+	clock := &testClock{now: time.Now()}
+	db, err := Open(filepath.Join(t.TempDir(), "db"), &Options{Clock: clock.Now, SweepInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		return txn.SetWithTTL("cache:a", "1", time.Second)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Add(time.Hour)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var keys int
+		db.Txn(func(txn *Txn) error {
+			keys = txn.t.Bucket([]byte("cache")).Stats().KeyN
+			return nil
+		}, true)
+		if keys == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the expired key is not purged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// close stops the sweeper
+	db.Close()
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The versions of the keys are stored in the bucket "_v", they are allocated from one sequence,
+// so a key that is deleted and created again never gets an old version.
+// Keys in the buckets starting with "_" are not versioned.
+const versionSequenceKey = "_vseq"
+
+var ErrVersionMismatch = errors.New("version mismatch")
+
+func isVersioned(key string) bool {
+	return !isInternal(key)
+}
+
+func versionKey(key string) string {
+	return "_v:" + key
+}
+
+func (txn *Txn) nextVersion() (uint64, error) {
+	v, err := txn.CounterAdd(versionSequenceKey, 1)
+	return uint64(v), err
+}
+
+func (txn *Txn) bumpVersion(key string, version uint64) error {
+	if !isVersioned(key) {
+		return nil
+	}
+	if version == 0 {
+		var err error
+		if version, err = txn.nextVersion(); err != nil {
+			return err
+		}
+	}
+	return txn.CounterSet(versionKey(key), int64(version))
+}
+
+func (txn *Txn) dropVersion(key string) error {
+	if !isVersioned(key) {
+		return nil
+	}
+	return txn.del(versionKey(key))
+}
+
+// Version returns the version of the key, 0 if the key does not exist or was written before versioning
+func (txn *Txn) Version(key string) uint64 {
+	v, _ := txn.CounterGet(versionKey(key))
+	return uint64(v)
+}
+
+func (txn *Txn) GetWithVersion(key string) ([]byte, uint64, error) {
+	val, err := txn.Get(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return val, txn.Version(key), nil
+}
+
+// SetIfVersion sets the value only if the version of the key is still version,
+// version 0 matches a key that does not exist (or has no version yet)
+func (txn *Txn) SetIfVersion(key string, value any, version uint64) error {
+	if current := txn.Version(key); current != version {
+		return errors.Wrapf(ErrVersionMismatch, "key: %s, expected: %d, actual: %d", key, version, current)
+	}
+	return txn.Set(key, value)
+}
+
+func (txn *Txn) DelIfVersion(key string, version uint64) error {
+	if current := txn.Version(key); current != version {
+		return errors.Wrapf(ErrVersionMismatch, "key: %s, expected: %d, actual: %d", key, version, current)
+	}
+	return txn.Del(key)
+}
+
+// ModelSetIfVersion saves the model only if the stored model is still of the version
+func (txn *Txn) ModelSetIfVersion(model, id any, version uint64) error {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" {
+		return err
+	}
+
+	key, _ := txn.modelKey(modelName, id)
+	if current := txn.Version(key); current != version {
+		return errors.Wrapf(ErrVersionMismatch, "key: %s, expected: %d, actual: %d", key, version, current)
+	}
+	return txn.ModelSet(model, id)
+}
+
+// ModelVersion returns the stored version of the model
+func (txn *Txn) ModelVersion(model, id any) uint64 {
+	modelName := modelNameOrEmpty(model)
+	if modelName == "" {
+		return 0
+	}
+	key, _ := txn.modelKey(modelName, id)
+	return txn.Version(key)
+}
+
+// versionField returns the settable field with the tag `db:"version"`
+func versionField(model any) (reflect.Value, bool) {
+	modelValue := reflect.ValueOf(model)
+	if modelValue.Kind() != reflect.Pointer || modelValue.IsNil() {
+		return reflect.Value{}, false
+	}
+	modelValue = modelValue.Elem()
+	if modelValue.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	modelType := modelValue.Type()
+	for i := 0; i < modelType.NumField(); i++ {
+		tag := modelType.Field(i).Tag.Get(tagName)
+		for _, v := range strings.Split(strings.Trim(tag, ", ;"), ",") {
+			if strings.TrimSpace(v) != "version" {
+				continue
+			}
+			field := modelValue.Field(i)
+			switch field.Kind() {
+			case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+				if field.CanSet() {
+					return field, true
+				}
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func setVersionField(field reflect.Value, version uint64) {
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		field.SetUint(version)
+	default:
+		field.SetInt(int64(version))
+	}
+}
+
+// loadVersion copies the stored version of the key into the version field of the model
+func (txn *Txn) loadVersion(key string, model any) {
+	if field, ok := versionField(model); ok {
+		setVersionField(field, txn.Version(key))
+	}
+}
+
+// saveModel stores the model, the version field is bumped to the version of the write
+func (txn *Txn) saveModel(key string, model any) error {
+	codec := modelCodec(model)
+	field, ok := versionField(model)
+	if !ok {
+		return txn.setEncoded(key, model, 0, codec)
+	}
+
+	version, err := txn.nextVersion()
+	if err != nil {
+		return err
+	}
+	setVersionField(field, version)
+	return txn.setEncoded(key, model, version, codec)
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.SetIfVersion("doc:1", "a", 0); err != nil {
+			return err
+		}
+		_, v1, err := txn.GetWithVersion("doc:1")
+		if err != nil {
+			return err
+		}
+		if v1 == 0 {
+			t.Error("expected a version")
+		}
+
+		if err := txn.SetIfVersion("doc:1", "b", v1); err != nil {
+			return err
+		}
+		if err := txn.SetIfVersion("doc:1", "c", v1); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("expected version mismatch, got %v", err)
+		}
+
+		v2 := txn.Version("doc:1")
+		if v2 <= v1 {
+			t.Errorf("version is not increasing: %d -> %d", v1, v2)
+		}
+		if err := txn.DelIfVersion("doc:1", v1); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("expected version mismatch, got %v", err)
+		}
+		if err := txn.DelIfVersion("doc:1", v2); err != nil {
+			return err
+		}
+
+		// a new key never gets an old version
+		if err := txn.Set("doc:1", "d"); err != nil {
+			return err
+		}
+		if v3 := txn.Version("doc:1"); v3 <= v2 {
+			t.Errorf("version is not increasing: %d -> %d", v2, v3)
+		}
+
+		// the counters are versioned like the other values
+		if err := txn.Set("doc:1", 1); err != nil {
+			return err
+		}
+		v4 := txn.Version("doc:1")
+		if _, err := txn.Inc("doc:1", 1); err != nil {
+			return err
+		}
+		if v5 := txn.Version("doc:1"); v5 <= v4 {
+			t.Errorf("version is not increasing: %d -> %d", v4, v5)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestModelVersion(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type Article struct {
+		Title   string
+		Version uint64 `db:"version"`
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSet(&Article{Title: "draft"}, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two editors read the same version
+	var a, b *Article
+	db.Txn(func(txn *Txn) error {
+		m, _ := txn.ModelGet(&Article{}, 1)
+		a = m.(*Article)
+		m, _ = txn.ModelGet(&Article{}, 1)
+		b = m.(*Article)
+		return nil
+	}, true)
+	if a.Version == 0 || a.Version != b.Version {
+		t.Fatalf("unexpected versions: %d, %d", a.Version, b.Version)
+	}
+
+	read := a.Version
+	a.Title = "first"
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSetIfVersion(a, 1, a.Version)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Version <= read {
+		t.Errorf("version is not bumped: %d", a.Version)
+	}
+
+	b.Title = "second"
+	err = db.Txn(func(txn *Txn) error {
+		return txn.ModelSetIfVersion(b, 1, b.Version)
+	})
+	if !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expected version mismatch, got %v", err)
+	}
+
+	db.Txn(func(txn *Txn) error {
+		m, _ := txn.ModelGet(&Article{}, 1)
+		if got := m.(*Article); got.Title != "first" || got.Version != a.Version {
+			t.Errorf("unexpected article: %+v", got)
+		}
+		return nil
+	}, true)
+}
@@ -54,6 +54,24 @@ func GzipUncompress(src []byte) ([]byte, error) {
 	return io.ReadAll(zr)
 }
 
+// decodeValue returns a copy of the stored value, which is uncompressed if it was compressed
+func decodeValue(val []byte) []byte {
+	decode, _ := uncompress(val)
+	return decode
+}
+
+// uncompress returns a copy of the value, and whether it was compressed
+func uncompress(val []byte) ([]byte, bool) {
+	if val == nil {
+		return nil, false
+	}
+	decode, err := GzipUncompress(val)
+	if err != nil {
+		return append([]byte{}, val...), false
+	}
+	return decode, true
+}
+
 func PaddingZero(val any, length int) string {
 	text := fmt.Sprintf("%v", val)
 	diff := length - len(text)
@@ -126,7 +144,20 @@ func ParseReflectValue(val reflect.Value) (any, bool) {
 	return val.Interface(), true
 }
 
+// ToModelName returns the name of the model, see Register.
+// It is empty for a model that is rejected by the registry, the model functions with an error result report the error.
 func ToModelName(model any) string {
+	return modelNameOrEmpty(model)
+}
+
+// modelNameOrEmpty returns the name of the model for the functions without an error result,
+// they return their zero values for a model that is rejected by the registry
+func modelNameOrEmpty(model any) string {
+	name, _ := modelNameOf(model)
+	return name
+}
+
+func deriveModelName(model any) string {
 	v := reflect.ValueOf(model)
 	k := v.Kind()
 	if k == reflect.Invalid {
@@ -149,6 +180,18 @@ func ToModelName(model any) string {
 	return ToSnake(name)
 }
 
+// The first key after all keys with the prefix, nil if there is no such key
+func prefixSuccessor(prefix []byte) []byte {
+	succ := append([]byte(nil), prefix...)
+	for i := len(succ) - 1; i >= 0; i-- {
+		if succ[i] < 0xff {
+			succ[i]++
+			return succ[:i+1]
+		}
+	}
+	return nil
+}
+
 func GetBucket(key string) string {
 	b, _, _ := strings.Cut(key, ":")
 	if b == "" {
@@ -157,16 +200,39 @@ func GetBucket(key string) string {
 	return b
 }
 
+// Keys in the buckets starting with "_" are maintained by the database
+func isInternal(key string) bool {
+	return strings.HasPrefix(GetBucket(key), "_")
+}
+
 func ToSnake(text string) string {
 	return strcase.ToSnakeWithIgnore(text, ".")
 }
 
+// GenerateIndexBaseKey is empty for a model that is rejected by the registry, see Register
 func GenerateIndexBaseKey(model any, field string, val any) string {
-	modelName := ToModelName(model)
+	modelName := modelNameOrEmpty(model)
+	if modelName == "" {
+		return ""
+	}
+	return indexBaseKey(modelName, field, val)
+}
+
+// indexBaseKey returns the base key of the index of the model
+func indexBaseKey(modelName string, field string, val any) string {
 	snakeField := ToSnake(field)
 	return strings.ToLower(fmt.Sprintf("%s:%s:%v", modelName, snakeField, val))
 }
 
+// modelIndexBaseKey returns the base key of the index, or the error of the name of the model
+func modelIndexBaseKey(model any, field string, val any) (string, error) {
+	modelName, err := modelNameOf(model)
+	if err != nil {
+		return "", err
+	}
+	return indexBaseKey(modelName, field, val), nil
+}
+
 func NewModel(model any) any {
 	modelVal := reflect.ValueOf(model)
 	k := modelVal.Kind()
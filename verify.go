@@ -0,0 +1,233 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+type IssueType string
+
+const (
+	IssueTotal        IssueType = "total"         // "_total:" differs from the number of models
+	IssueCounter      IssueType = "counter"       // "_counter:" is behind the largest numeric id
+	IssueMissingIndex IssueType = "missing_index" // an index entry of a model is missing
+	IssueOrphanIndex  IssueType = "orphan_index"  // an index entry whose model or value is gone
+	IssueIndexCount   IssueType = "index_count"   // "_ic:" differs from the number of index entries
+	IssueInvalidModel IssueType = "invalid_model" // a model can not be decoded, it is not repaired
+)
+
+type Issue struct {
+	Type     IssueType
+	Model    string
+	Key      string
+	Expected int64
+	Actual   int64
+	ID       string // the id of the model of a missing index entry
+	Repaired bool
+}
+
+func (i Issue) String() string {
+	switch i.Type {
+	case IssueMissingIndex, IssueOrphanIndex, IssueInvalidModel:
+		return fmt.Sprintf("%s: %s", i.Type, i.Key)
+	}
+	return fmt.Sprintf("%s: %s, expected: %d, actual: %d", i.Type, i.Key, i.Expected, i.Actual)
+}
+
+type VerifyOptions struct {
+	Models    []any // The models to check, the indexes are derived from their tags, the registered models by default
+	Repair    bool  // Fix the issues in batched write transactions
+	BatchSize int   // The number of issues fixed in one transaction, 1000 by default
+}
+
+type VerifyReport struct {
+	Models int // the number of checked models
+	Issues []Issue
+}
+
+// Verify cross-checks the stored models against their indexes and counters.
+// Each model is checked in one read transaction, so run the repair while the models are not written.
+func (t *DB) Verify(opts *VerifyOptions) (report VerifyReport, err error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	models := opts.Models
+	if len(models) == 0 {
+		models = registeredModels()
+	}
+	if len(models) == 0 {
+		return report, errors.Wrap(ErrUnregisteredModel, "verify: no models are selected or registered")
+	}
+	for _, model := range models {
+		var issues []Issue
+		err = t.view(func(tx *bolt.Tx) error {
+			var n int
+			issues, n, err = verifyModel(&Txn{t: tx, db: t}, model)
+			report.Models += n
+			return err
+		})
+		if err != nil {
+			return
+		}
+		if opts.Repair {
+			if err = t.repair(issues, opts.BatchSize); err != nil {
+				return
+			}
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+	return
+}
+
+func verifyModel(txn *Txn, model any) (issues []Issue, n int, err error) {
+	modelName, err := modelNameOf(model)
+	if err != nil || modelName == "" || NewModel(model) == nil {
+		return nil, 0, err
+	}
+
+	// the index entries and counts derived from the models
+	entries := map[string]string{}
+	counts := map[string]int64{}
+	// only the ids of the counter follow it, such as not snowflake ids
+	_, counterIDs := GetIDGenerator(model).(*CounterID)
+	var maxID int64
+	prefix := modelName + ":"
+	err = txn.List(prefix, func(key string, value []byte) (bool, error) {
+		m := NewModel(model)
+		if _, err := decodeModel(value, m); err != nil {
+			issues = append(issues, Issue{Type: IssueInvalidModel, Model: modelName, Key: key})
+			return false, nil
+		}
+		n++
+
+		id := strings.TrimPrefix(key, prefix)
+		if i, ok := counterID(id); counterIDs && ok && i > maxID {
+			maxID = i
+		}
+
+		return false, eachIndex(m, func(modelName, indexName string, val any) error {
+			baseKey := GenerateIndexBaseKey(modelName, indexName, val)
+			key := indexKey(baseKey, id)
+			if _, ok := entries[key]; !ok {
+				entries[key] = id
+				counts[baseKey]++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return
+	}
+
+	if total := txn.modelTotal(modelName); total != int64(n) {
+		issues = append(issues, Issue{Type: IssueTotal, Model: modelName, Key: "_total:" + modelName, Expected: int64(n), Actual: total})
+	}
+	if counter := txn.modelCounter(modelName); counter < maxID {
+		issues = append(issues, Issue{Type: IssueCounter, Model: modelName, Key: "_counter:" + modelName, Expected: maxID, Actual: counter})
+	}
+
+	// the base keys of the indexes are lower case
+	indexPrefix := strings.ToLower(modelName) + ":"
+	err = txn.List("_i:"+indexPrefix, func(key string, value []byte) (bool, error) {
+		if _, ok := entries[key]; ok {
+			delete(entries, key)
+		} else {
+			issues = append(issues, Issue{Type: IssueOrphanIndex, Model: modelName, Key: key})
+		}
+		return false, nil
+	}, &ListOption{KeyOnly: true})
+	if err != nil {
+		return
+	}
+	for _, key := range sortedKeys(entries) {
+		issues = append(issues, Issue{Type: IssueMissingIndex, Model: modelName, Key: key, ID: entries[key]})
+	}
+
+	err = txn.List("_ic:"+indexPrefix, func(key string, value []byte) (bool, error) {
+		baseKey := strings.TrimPrefix(key, "_ic:")
+		actual, _ := txn.CounterGet(key)
+		if expected := counts[baseKey]; actual != expected {
+			issues = append(issues, Issue{Type: IssueIndexCount, Model: modelName, Key: key, Expected: expected, Actual: actual})
+		}
+		delete(counts, baseKey)
+		return false, nil
+	}, &ListOption{KeyOnly: true})
+	if err != nil {
+		return
+	}
+	for _, baseKey := range sortedKeys(counts) {
+		issues = append(issues, Issue{Type: IssueIndexCount, Model: modelName, Key: "_ic:" + baseKey, Expected: counts[baseKey]})
+	}
+	return
+}
+
+// counterID returns the number of a padded or sortable counter id
+func counterID(id string) (int64, bool) {
+	if i, err := strconv.ParseInt(id, 10, 64); err == nil {
+		return i, true
+	}
+	if i, err := ParseSortableID(id); err == nil {
+		return i, true
+	}
+	return 0, false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// repair fixes the issues in batched write transactions
+func (t *DB) repair(issues []Issue, size int) error {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	for begin := 0; begin < len(issues); begin += size {
+		end := begin + size
+		if end > len(issues) {
+			end = len(issues)
+		}
+		batch := issues[begin:end]
+		err := t.Txn(func(txn *Txn) error {
+			for i := range batch {
+				if err := repairIssue(txn, batch[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range batch {
+			batch[i].Repaired = batch[i].Type != IssueInvalidModel
+		}
+	}
+	return nil
+}
+
+func repairIssue(txn *Txn, issue Issue) error {
+	switch issue.Type {
+	case IssueTotal, IssueCounter:
+		return txn.CounterSet(issue.Key, issue.Expected)
+	case IssueMissingIndex:
+		return txn.Set(issue.Key, issue.ID)
+	case IssueOrphanIndex:
+		return txn.Del(issue.Key)
+	case IssueIndexCount:
+		if issue.Expected == 0 {
+			return txn.CounterReset(issue.Key)
+		}
+		return txn.CounterSet(issue.Key, issue.Expected)
+	}
+	return nil
+}
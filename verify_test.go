@@ -0,0 +1,166 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+type verifyUser struct {
+	Name string `db:"index"`
+}
+
+func TestVerifyRepair(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Txn(func(txn *Txn) error {
+		for _, name := range []string{"alice", "bob"} {
+			if err := txn.ModelSet(&verifyUser{Name: name}, txn.ModelNextID(&verifyUser{}, 0)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &VerifyOptions{Models: []any{&verifyUser{}}}
+	report, err := db.Verify(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Models != 2 || len(report.Issues) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// break the data behind the back of ModelSet and ModelDel
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.Set("verify_user:3", &verifyUser{Name: "carol"}); err != nil {
+			return err
+		}
+		if err := txn.Del("verify_user:1"); err != nil {
+			return err
+		}
+		_, err := txn.CounterAdd("_ic:verify_user:name:bob", 5)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Repair = true
+	report, err = db.Verify(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[IssueType]int{}
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			t.Errorf("expected the issue to be repaired: %s", issue)
+		}
+		found[issue.Type]++
+	}
+	// the total is right by chance, one model is gone and one is added
+	expected := map[IssueType]int{IssueCounter: 1, IssueOrphanIndex: 1, IssueMissingIndex: 1, IssueIndexCount: 3}
+	for typ, n := range expected {
+		if found[typ] != n {
+			t.Errorf("expected %d issues of %s but got %d: %v", n, typ, found[typ], report.Issues)
+		}
+	}
+
+	opts.Repair = false
+	report, err = db.Verify(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("unexpected issues after the repair: %v", report.Issues)
+	}
+	err = db.Txn(func(txn *Txn) error {
+		if ids, _ := txn.IndexList(&verifyUser{}, "Name", "carol"); len(ids) != 1 || ids[0] != "3" {
+			t.Errorf("unexpected index: %v", ids)
+		}
+		if c := txn.ModelCounter(&verifyUser{}); c != 3 {
+			t.Errorf("expected counter 3 but got %d", c)
+		}
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type verifySnow struct {
+	Name string `db:"id=snowflake"`
+}
+
+func TestVerifyGeneratedIDs(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the snowflake ids are numbers, but not of the counter
+	err = db.Txn(func(txn *Txn) error {
+		id, err := txn.ModelNewID(&verifySnow{})
+		if err != nil {
+			return err
+		}
+		return txn.ModelSet(&verifySnow{Name: "a"}, id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := db.Verify(&VerifyOptions{Models: []any{&verifySnow{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("unexpected issues: %v", report.Issues)
+	}
+}
+
+type verifyRegistered struct {
+	Name string
+}
+
+func TestVerifyRegistered(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := Register[verifyRegistered]("verify_registered", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.ModelSet(&verifyRegistered{Name: "a"}, 1); err != nil {
+			return err
+		}
+		return txn.CounterSet("_total:verify_registered", 5)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the registered models are checked by default
+	report, err := db.Verify(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, issue := range report.Issues {
+		if issue.Type == IssueTotal && issue.Model == "verify_registered" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the total issue but got %v", report.Issues)
+	}
+}
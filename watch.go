@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type EventType int
+
+const (
+	EventPut EventType = iota + 1
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event is a change of a key, the values are uncompressed.
+// Changes written by ModelSet and ModelDel carry the decoded models.
+type Event struct {
+	Type EventType
+	Key  string
+	Old  []byte // nil if the key did not exist
+	New  []byte // nil for delete
+	Seq  uint64 // the sequence of the commit, the events of one transaction share it
+
+	// the number of events dropped before this one, because the watcher fell behind, see Options.WatchQueue
+	Dropped uint64
+
+	Model    string // the model name
+	OldModel any    // nil if the model did not exist
+	NewModel any    // nil for delete
+}
+
+const watchBuffer = 64
+
+type watcher struct {
+	ctx    context.Context
+	prefix string
+	ch     chan Event
+	size   int // the maximum number of queued events
+
+	mu      sync.Mutex
+	queue   []Event
+	dropped uint64
+	notify  chan struct{}
+}
+
+// push queues the event without blocking, the events beyond the size of the queue are dropped
+func (w *watcher) push(e Event) {
+	w.mu.Lock()
+	if len(w.queue) >= w.size {
+		w.dropped++
+	} else {
+		e.Dropped = w.dropped
+		w.dropped = 0
+		w.queue = append(w.queue, e)
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends the queued events to the channel until ctx is done or stop is closed
+func (w *watcher) deliver(stop <-chan struct{}) {
+	for {
+		select {
+		case <-w.notify:
+		case <-w.ctx.Done():
+			return
+		case <-stop:
+			return
+		}
+
+		w.mu.Lock()
+		events := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+
+		for _, e := range events {
+			select {
+			case w.ch <- e:
+			case <-w.ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+type watchers struct {
+	mu    sync.RWMutex
+	list  map[*watcher]struct{}
+	count atomic.Int32
+	seq   atomic.Uint64
+}
+
+// Watch returns the events of the committed changes of the keys with the prefix.
+// The channel is closed when ctx is done or the database is closed.
+// The writers do not wait for a slow reader, the events are dropped when it falls too far behind, see Event.Dropped.
+func (t *DB) Watch(ctx context.Context, prefix string) <-chan Event {
+	w := &watcher{ctx: ctx, prefix: prefix, ch: make(chan Event, watchBuffer), size: t.opts.WatchQueue, notify: make(chan struct{}, 1)}
+
+	t.watchers.mu.Lock()
+	if t.watchers.list == nil {
+		t.watchers.list = map[*watcher]struct{}{}
+	}
+	t.watchers.list[w] = struct{}{}
+	t.watchers.count.Add(1)
+	t.watchers.mu.Unlock()
+
+	go func() {
+		w.deliver(t.stop)
+
+		t.watchers.mu.Lock()
+		delete(t.watchers.list, w)
+		t.watchers.count.Add(-1)
+		close(w.ch)
+		t.watchers.mu.Unlock()
+	}()
+	return w.ch
+}
+
+func (t *DB) watching() bool {
+	return t.watchers.count.Load() > 0
+}
+
+// publish queues the events of a committed transaction for the watchers, it does not block
+func (t *DB) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	seq := t.watchers.seq.Add(1)
+	t.watchers.mu.RLock()
+	defer t.watchers.mu.RUnlock()
+	for _, e := range events {
+		e.Seq = seq
+		for w := range t.watchers.list {
+			if strings.HasPrefix(e.Key, w.prefix) {
+				w.push(e)
+			}
+		}
+	}
+}
+
+// annotateModel adds the models to the last event of the key
+func (txn *Txn) annotateModel(key, modelName string, old, new any) {
+	for i := len(txn.events) - 1; i >= 0; i-- {
+		if txn.events[i].Key == key {
+			txn.events[i].Model = modelName
+			txn.events[i].OldModel = old
+			txn.events[i].NewModel = new
+			return
+		}
+	}
+}
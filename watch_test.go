@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	db, err := New(filepath.Join(t.TempDir(), "db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := db.Watch(ctx, "user:")
+
+	type User struct {
+		Name string `db:"index"`
+	}
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.Set("user:a", "1"); err != nil {
+			return err
+		}
+		return txn.Set("other:a", "1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the events of a failed transaction are dropped
+	db.Txn(func(txn *Txn) error {
+		txn.Set("user:b", "1")
+		return errors.New("rollback")
+	})
+
+	err = db.Txn(func(txn *Txn) error {
+		if err := txn.ModelSet(&User{Name: "a"}, 1); err != nil {
+			return err
+		}
+		if err := txn.ModelSet(&User{Name: "b"}, 1); err != nil {
+			return err
+		}
+		return txn.Del("user:a")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := func() Event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+		return Event{}
+	}
+
+	e := next()
+	if e.Type != EventPut || e.Key != "user:a" || string(e.New) != "1" || e.Old != nil {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	first := e.Seq
+
+	e = next()
+	if e.Key != "user:1" || e.Model != "user" || e.OldModel != nil || e.NewModel.(*User).Name != "a" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if e.Seq != first+1 {
+		t.Errorf("unexpected seq: %d", e.Seq)
+	}
+
+	e = next()
+	if e.Key != "user:1" || e.OldModel.(*User).Name != "a" || e.NewModel.(*User).Name != "b" || string(e.Old) != `{"Name":"a"}` {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	e = next()
+	if e.Type != EventDelete || e.Key != "user:a" || string(e.Old) != "1" {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchSlowReader(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "db"), &Options{WatchQueue: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := db.Watch(ctx, "item:")
+
+	// the writers do not wait for the reader
+	done := make(chan error, 1)
+	go func() {
+		err := db.Txn(func(txn *Txn) error {
+			for i := 0; i < 300; i++ {
+				if err := txn.Set(fmt.Sprintf("item:%d", i), "1"); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			err = db.Txn(func(txn *Txn) error {
+				return txn.Set("item:last", "1")
+			})
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the writers are blocked")
+	}
+
+	// every event is received or counted as dropped
+	var received, dropped uint64
+	for received+dropped < 301 {
+		select {
+		case e := <-events:
+			received++
+			dropped += e.Dropped
+		case <-time.After(time.Second):
+			t.Fatalf("received %d, dropped %d", received, dropped)
+		}
+	}
+	if dropped == 0 {
+		t.Error("expected the events to be dropped")
+	}
+}